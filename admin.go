@@ -0,0 +1,71 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// updateUserRole lets an admin change the role of a user. The new role is
+// part of the user's access tokens from their next login or refresh.
+func (cfg *apiConfig) updateUserRole(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	type parameters struct {
+		Role string `json:"role"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	if !auth.ValidRole(params.Role) {
+		writeErrorJson(w, errors.New("invalid role"), "Role must be one of: "+strings.Join(auth.Roles, ", "))
+		return
+	}
+
+	// Admins cannot demote themselves, so there is always one left.
+	if caller, ok := principalFromContext(r.Context()); ok && caller.UserID == userID && params.Role != auth.RoleAdmin {
+		w.WriteHeader(http.StatusConflict)
+		writeErrorJson(w, errors.New("admin demoting themselves"), "You cannot change your own role")
+		return
+	}
+
+	user, err := cfg.sql.UpdateUserRole(r.Context(), database.UpdateUserRoleParams{ID: userID, Role: params.Role})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't update user")
+		return
+	}
+
+	type response struct {
+		ID        uuid.UUID `json:"id"`
+		UpdatedAt time.Time `json:"updated_at"`
+		Email     string    `json:"email"`
+		Role      string    `json:"role"`
+	}
+	resp := response{user.ID, user.UpdatedAt, user.Email, user.Role}
+
+	writeSuccessJson(w, resp)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	errInsufficientScope = errors.New("token lacks the required scope")
+	errSessionRequired   = errors.New("a login session is required")
+	errInsufficientRole  = errors.New("user lacks the required role")
+)
+
+// principal is the authenticated caller of a request.
+type principal struct {
+	UserID uuid.UUID
+	// Role is the role of a login session. Delegated tokens always act with
+	// the plain user role.
+	Role string
+	// Scopes limits what the caller may do. It is nil for a login session,
+	// which may do everything its user can.
+	Scopes []string
+	// Claims are set when the caller presented a JWT.
+	Claims *auth.Claims
+}
+
+// SessionID returns the login session the caller authenticated with, or
+// uuid.Nil if the caller did not use a login session token.
+func (p *principal) SessionID() uuid.UUID {
+	if p.Claims == nil || p.Claims.Delegated() {
+		return uuid.Nil
+	}
+	sessionID, err := uuid.Parse(p.Claims.SessionID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return sessionID
+}
+
+// HasScope reports whether the caller may act within scope.
+func (p *principal) HasScope(scope string) bool {
+	return p.Scopes == nil || slices.Contains(p.Scopes, scope)
+}
+
+// authenticate identifies the caller from the bearer token in the
+// Authorization header, which is either an access token JWT that has not
+// been revoked or a personal access token. JWTs issued to OAuth clients are
+// limited to the scopes they were granted. Browsers without the header may
+// send the access token cookie instead.
+func (cfg *apiConfig) authenticate(r *http.Request) (*principal, error) {
+	token, _, err := requestToken(r, accessTokenCookie)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth.IsPersonalAccessToken(token) {
+		if usesDPoPScheme(r) {
+			return nil, errDPoPUnbound
+		}
+
+		pat, err := cfg.sql.GetPersonalAccessTokenByHash(r.Context(), auth.HashToken(token))
+		if err != nil {
+			return nil, err
+		}
+
+		err = cfg.sql.TouchPersonalAccessToken(r.Context(), pat.ID)
+		if err != nil {
+			log.Printf("Error updating personal access token: %s", err)
+		}
+
+		scopes := pat.Scopes
+		if scopes == nil {
+			scopes = []string{}
+		}
+		return &principal{UserID: pat.UserID, Role: auth.RoleUser, Scopes: scopes}, nil
+	}
+
+	claims, err := auth.ParseJWT(token, cfg.keys, cfg.jwtOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.denylist.IsRevoked(claims.ID) {
+		return nil, errors.New("token has been revoked")
+	}
+	if claims.SessionID != "" && cfg.denylist.IsRevoked(claims.SessionID) {
+		return nil, errors.New("session has been revoked")
+	}
+
+	err = cfg.checkDPoPBinding(r, token, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	caller := &principal{UserID: claims.UserID(), Role: claims.Role, Claims: claims}
+	if claims.Delegated() {
+		caller.Role = auth.RoleUser
+		caller.Scopes = claims.Scopes()
+		if caller.Scopes == nil {
+			caller.Scopes = []string{}
+		}
+	}
+	if caller.Role == "" {
+		// Tokens issued before roles were introduced.
+		caller.Role = auth.RoleUser
+	}
+	return caller, nil
+}
+
+// authorize authenticates the caller and checks that they may act within scope.
+func (cfg *apiConfig) authorize(r *http.Request, scope string) (*principal, error) {
+	caller, err := cfg.authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	if !caller.HasScope(scope) {
+		return nil, errInsufficientScope
+	}
+	return caller, nil
+}
+
+// authorizeOptional checks the token of a request to a public endpoint. A
+// request without a token is let through, but a token that is sent must be
+// valid and carry scope.
+func (cfg *apiConfig) authorizeOptional(r *http.Request, scope string) error {
+	if !hasRequestToken(r, accessTokenCookie) {
+		return nil
+	}
+	_, err := cfg.authorize(r, scope)
+	return err
+}
+
+// authorizeSession authenticates the caller and requires a login session.
+// Account security settings cannot be changed with delegated tokens.
+func (cfg *apiConfig) authorizeSession(r *http.Request) (*principal, error) {
+	caller, err := cfg.authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	if caller.Scopes != nil {
+		return nil, errSessionRequired
+	}
+	return caller, nil
+}
+
+// authorizeRole authenticates the caller and requires a login session of a
+// user with at least the given role.
+func (cfg *apiConfig) authorizeRole(r *http.Request, role string) (*principal, error) {
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		return nil, err
+	}
+	if !auth.HasRole(caller.Role, role) {
+		return nil, errInsufficientRole
+	}
+	return caller, nil
+}
+
+type principalContextKey struct{}
+
+// middlewareRequireRole only lets requests from users with at least role
+// through to next, which can get the caller with principalFromContext.
+// Operators can also use the ADMIN_API_KEY, in which case there is no
+// caller in the context.
+func (cfg *apiConfig) middlewareRequireRole(role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey, err := auth.GetAPIKey(r.Header)
+		if err == nil && cfg.adminKey != "" && subtle.ConstantTimeCompare([]byte(apiKey), []byte(cfg.adminKey)) == 1 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		caller, err := cfg.authorizeRole(r, role)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writeAuthError(w, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalContextKey{}, caller)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// principalFromContext returns the caller stored by middlewareRequireRole.
+func principalFromContext(ctx context.Context) (*principal, bool) {
+	caller, ok := ctx.Value(principalContextKey{}).(*principal)
+	return caller, ok
+}
+
+// writeAuthError responds to a failed authorize or authenticate call.
+func writeAuthError(w http.ResponseWriter, err error) {
+	if isDPoPError(err) {
+		w.Header().Set("WWW-Authenticate", `DPoP error="invalid_dpop_proof", algs="ES256 ES384 RS256 PS256 EdDSA"`)
+	}
+	if errors.Is(err, errInsufficientScope) || errors.Is(err, errSessionRequired) || errors.Is(err, errInsufficientRole) ||
+		errors.Is(err, errCSRFTokenMismatch) {
+		w.WriteHeader(http.StatusForbidden)
+	} else {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	writeErrorJson(w, err, "Something went wrong")
+}
+
+// denylistStore keeps the access token denylist in the revoked_access_tokens table.
+type denylistStore struct {
+	sql *database.Queries
+}
+
+func (s denylistStore) AddRevokedToken(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error {
+	return s.sql.CreateRevokedAccessToken(ctx, database.CreateRevokedAccessTokenParams{
+		Jti:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+func (s denylistStore) RevokedTokensSince(ctx context.Context, since time.Time) ([]auth.RevokedToken, error) {
+	rows, err := s.sql.GetRevokedAccessTokensSince(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]auth.RevokedToken, 0, len(rows))
+	for _, row := range rows {
+		tokens = append(tokens, auth.RevokedToken{ID: row.Jti, ExpiresAt: row.ExpiresAt})
+	}
+	return tokens, nil
+}
+
+func (s denylistStore) PruneRevokedTokens(ctx context.Context, before time.Time) error {
+	return s.sql.DeleteExpiredRevokedAccessTokens(ctx, before)
+}
@@ -33,18 +33,26 @@ func (cfg *apiConfig) createChirp(w http.ResponseWriter, r *http.Request) {
 
 	cleanedBody := replaceProfane(params.Body)
 
-	token, err := auth.GetBearerToken(r.Header)
+	caller, err := cfg.authorize(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		writeErrorJson(w, err, "Something went wrong")
+		writeAuthError(w, err)
 		return
 	}
+	userID := caller.UserID
 
-	userID, err := auth.ValidateJWT(token, cfg.secret)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		writeErrorJson(w, err, "Something went wrong")
-		return
+	if cfg.requireVerifiedEmail {
+		user, err := cfg.sql.GetUserByID(r.Context(), userID)
+		if err != nil {
+			writeErrorJson(w, err, "Couldn't get user")
+			return
+		}
+		// Accounts from before verification existed may keep chirping, but
+		// they still count as unverified everywhere else.
+		if !user.EmailVerifiedAt.Valid && !user.LegacyUnverified {
+			w.WriteHeader(http.StatusForbidden)
+			writeErrorJson(w, errors.New("email not verified"), "Verify your email address before chirping")
+			return
+		}
 	}
 
 	chirp, err := cfg.sql.CreateChirp(r.Context(), database.CreateChirpParams{
@@ -88,6 +96,12 @@ func replaceProfane(body string) string {
 func (cfg *apiConfig) indexChirps(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
+	err := cfg.authorizeOptional(r, auth.ScopeChirpsRead)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
 	var authorID uuid.NullUUID
 
 	paramAuthorID := r.URL.Query().Get("author_id")
@@ -126,6 +140,12 @@ func (cfg *apiConfig) indexChirps(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) showChirp(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
+	err := cfg.authorizeOptional(r, auth.ScopeChirpsRead)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
 		w.WriteHeader(http.StatusNotFound)
@@ -155,19 +175,12 @@ func (cfg *apiConfig) showChirp(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		writeErrorJson(w, err, "Something went wrong")
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.secret)
+	caller, err := cfg.authorize(r, auth.ScopeChirpsWrite)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		writeErrorJson(w, err, "Something went wrong")
+		writeAuthError(w, err)
 		return
 	}
+	userID := caller.UserID
 
 	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
@@ -183,7 +196,8 @@ func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if chirp.UserID != userID {
+	// Moderators may remove any chirp, everyone else only their own.
+	if chirp.UserID != userID && !auth.HasRole(caller.Role, auth.RoleModerator) {
 		w.WriteHeader(http.StatusForbidden)
 		writeErrorJson(w, errors.New("not owner"), "Something went wrong")
 		return
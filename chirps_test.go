@@ -0,0 +1,45 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/database"
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestCreateChirpRequiresVerifiedEmail(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	cfg.requireVerifiedEmail = true
+
+	unverified := createTestUser(t, cfg, "new@example.com")
+	verified := createTestUser(t, cfg, "verified@example.com")
+	legacy := createTestUser(t, cfg, "legacy@example.com")
+
+	_, err := cfg.sql.VerifyUserEmail(context.Background(), database.VerifyUserEmailParams{ID: verified.ID, Email: verified.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.db.Exec("UPDATE users SET legacy_unverified = TRUE WHERE id = $1", legacy.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		email string
+		want  int
+	}{
+		{unverified.Email, http.StatusForbidden},
+		{verified.Email, http.StatusCreated},
+		{legacy.Email, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		session := loginTestUser(t, cfg, tt.email)
+		rr := serve(cfg.createChirp, withBearer(newJSONRequest(http.MethodPost, "/api/chirps", map[string]any{
+			"body": "Hello, world!",
+		}), session.Token))
+		if rr.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.email, rr.Code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"crypto/subtle"
+	"errors"
+	"mime"
+	"net/http"
+)
+
+// Browsers can keep their session in cookies instead of handling tokens in
+// JavaScript. Since cookies are sent along with cross-site requests, every
+// state-changing request authenticated by cookie must also echo the CSRF
+// cookie in the CSRF header (the double-submit pattern).
+const (
+	accessTokenCookie  = "chirpy_access_token"
+	refreshTokenCookie = "chirpy_refresh_token"
+	csrfCookie         = "chirpy_csrf_token"
+	csrfHeader         = "X-CSRF-Token"
+)
+
+var (
+	errCSRFTokenMismatch = errors.New("missing or invalid csrf token")
+	errLoginNotJSON      = errors.New("cookie logins must be sent as json")
+	errLoginCrossSite    = errors.New("cookie logins cannot be started from another site")
+)
+
+// setSessionCookies stores the tokens of a session in HttpOnly cookies,
+// along with a fresh CSRF token readable by the app.
+func (cfg *apiConfig) setSessionCookies(w http.ResponseWriter, accessToken, refreshToken string) error {
+	csrfToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     accessTokenCookie,
+		Value:    accessToken,
+		Path:     "/",
+		MaxAge:   int(accessTokenDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	// The refresh token is only needed to refresh or end the session.
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshTokenCookie,
+		Value:    refreshToken,
+		Path:     "/api",
+		MaxAge:   int(refreshTokenDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.secureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		MaxAge:   int(refreshTokenDuration.Seconds()),
+		Secure:   cfg.secureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+// clearSessionCookies removes the cookies set by setSessionCookies.
+func (cfg *apiConfig) clearSessionCookies(w http.ResponseWriter) {
+	for name, path := range map[string]string{accessTokenCookie: "/", refreshTokenCookie: "/api", csrfCookie: "/"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     path,
+			MaxAge:   -1,
+			HttpOnly: name != csrfCookie,
+			Secure:   cfg.secureCookies,
+		})
+	}
+}
+
+// requestToken returns the bearer or DPoP token of r or, for requests
+// without an Authorization header, the token in the named cookie. fromCookie reports
+// which one was used; cookies are only accepted with a valid CSRF token.
+func requestToken(r *http.Request, cookieName string) (token string, fromCookie bool, err error) {
+	if usesDPoPScheme(r) {
+		token, err = auth.GetDPoPToken(r.Header)
+		return token, false, err
+	}
+	if r.Header.Get("Authorization") != "" {
+		token, err = auth.GetBearerToken(r.Header)
+		return token, false, err
+	}
+
+	cookie, err := r.Cookie(cookieName)
+	if err != nil {
+		// Report the missing header like API clients have always seen it.
+		_, err = auth.GetBearerToken(r.Header)
+		return "", false, err
+	}
+
+	err = checkCSRF(r)
+	if err != nil {
+		return "", true, err
+	}
+	return cookie.Value, true, nil
+}
+
+// hasRequestToken reports whether r carries a bearer token or the named cookie.
+func hasRequestToken(r *http.Request, cookieName string) bool {
+	if r.Header.Get("Authorization") != "" {
+		return true
+	}
+	_, err := r.Cookie(cookieName)
+	return err == nil
+}
+
+// checkCSRF requires state-changing requests to send the CSRF cookie value
+// in the CSRF header, which a cross-site attacker cannot read.
+func checkCSRF(r *http.Request) error {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return nil
+	}
+
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return errCSRFTokenMismatch
+	}
+	header := r.Header.Get(csrfHeader)
+	if subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) != 1 {
+		return errCSRFTokenMismatch
+	}
+	return nil
+}
+
+// checkCookieLogin guards logins that set session cookies, where there is no
+// CSRF token to check yet. Cross-site forms can only send simple content
+// types, so requiring JSON keeps other sites from logging a browser into an
+// account of their choosing.
+func checkCookieLogin(r *http.Request) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		return errLoginNotJSON
+	}
+	return nil
+}
+
+// checkCookieNavigation guards cookie logins that start with a top-level
+// navigation, which cannot be told apart from a cross-site link by its
+// content type. Browsers send Sec-Fetch-Site to tell where it came from;
+// "none" is a bookmark or an address typed by the user.
+func checkCookieNavigation(r *http.Request) error {
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return nil
+	}
+	return errLoginCrossSite
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/oidc"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		cookie  string
+		header  string
+		wantErr bool
+	}{
+		{"safe method", http.MethodGet, "", "", false},
+		{"matching token", http.MethodPost, "token", "token", false},
+		{"missing cookie", http.MethodPost, "", "token", true},
+		{"missing header", http.MethodPost, "token", "", true},
+		{"other token", http.MethodDelete, "token", "other", true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "/api/revoke", nil)
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: csrfCookie, Value: tt.cookie})
+		}
+		if tt.header != "" {
+			r.Header.Set(csrfHeader, tt.header)
+		}
+		if err := checkCSRF(r); (err != nil) != tt.wantErr {
+			t.Errorf("%s: checkCSRF() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRequestTokenFromCookie(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+	r.AddCookie(&http.Cookie{Name: refreshTokenCookie, Value: "from-cookie"})
+
+	_, fromCookie, err := requestToken(r, refreshTokenCookie)
+	if !errors.Is(err, errCSRFTokenMismatch) || !fromCookie {
+		t.Fatalf("cookie without csrf token: fromCookie = %v, error = %v", fromCookie, err)
+	}
+
+	r.AddCookie(&http.Cookie{Name: csrfCookie, Value: "csrf"})
+	r.Header.Set(csrfHeader, "csrf")
+	token, fromCookie, err := requestToken(r, refreshTokenCookie)
+	if err != nil || !fromCookie || token != "from-cookie" {
+		t.Fatalf("cookie with csrf token: token = %q, fromCookie = %v, error = %v", token, fromCookie, err)
+	}
+
+	// A header always wins over the cookie.
+	r.Header.Set("Authorization", "Bearer from-header")
+	token, fromCookie, err = requestToken(r, refreshTokenCookie)
+	if err != nil || fromCookie || token != "from-header" {
+		t.Fatalf("header and cookie: token = %q, fromCookie = %v, error = %v", token, fromCookie, err)
+	}
+}
+
+func TestCheckCookieLogin(t *testing.T) {
+	tests := []struct {
+		contentType string
+		wantErr     bool
+	}{
+		{"application/json", false},
+		{"application/json; charset=utf-8", false},
+		{"text/plain", true},
+		{"application/x-www-form-urlencoded", true},
+		{"multipart/form-data; boundary=x", true},
+		{"", true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/api/login", nil)
+		r.Header.Set("Content-Type", tt.contentType)
+		if err := checkCookieLogin(r); (err != nil) != tt.wantErr {
+			t.Errorf("checkCookieLogin(%q) error = %v, wantErr %v", tt.contentType, err, tt.wantErr)
+		}
+	}
+}
+
+func TestStartSSOLoginRefusesCrossSiteCookieLogins(t *testing.T) {
+	cfg := newTestConfigWithoutDB(t)
+	cfg.ssoProviders = map[string]*oidc.Provider{
+		"example": oidc.NewProvider(oidc.Config{Name: "example", Issuer: "https://idp.invalid", ClientID: "chirpy"}, nil),
+	}
+
+	for _, site := range []string{"cross-site", "same-site", ""} {
+		r := httptest.NewRequest(http.MethodGet, "/api/sso/example/login?use_cookies=true", nil)
+		r.SetPathValue("provider", "example")
+		if site != "" {
+			r.Header.Set("Sec-Fetch-Site", site)
+		}
+
+		rr := serve(cfg.startSSOLogin, r)
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("Sec-Fetch-Site %q: status %d, want %d", site, rr.Code, http.StatusForbidden)
+		}
+		if len(rr.Result().Cookies()) != 0 {
+			t.Errorf("Sec-Fetch-Site %q: cookies were set", site)
+		}
+	}
+}
+
+func TestCookieLoginMustBeJSON(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+
+	// A cross-site form can post text/plain that happens to be valid JSON.
+	body := `{"email": "alice@example.com", "password": "` + testPassword + `", "use_cookies": true}`
+	r := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body))
+	r.Header.Set("Content-Type", "text/plain")
+	rr := serve(cfg.createSession, r)
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("text/plain login: status %d, want %d", rr.Code, http.StatusUnsupportedMediaType)
+	}
+	if len(rr.Result().Cookies()) != 0 {
+		t.Fatal("text/plain login set cookies")
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	rr = serve(cfg.createSession, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("json login: status %d, body %s", rr.Code, rr.Body)
+	}
+	if tokens := decodeBody[sessionTokens](t, rr); tokens.Token != "" || tokens.RefreshToken != "" {
+		t.Error("cookie login returned the tokens in the body")
+	}
+
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range rr.Result().Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	for _, name := range []string{accessTokenCookie, refreshTokenCookie, csrfCookie} {
+		if cookies[name] == nil || cookies[name].Value == "" {
+			t.Fatalf("cookie %s was not set", name)
+		}
+	}
+	if !cookies[accessTokenCookie].HttpOnly || !cookies[refreshTokenCookie].HttpOnly {
+		t.Error("session cookies are readable by scripts")
+	}
+
+	refresh := func(csrfToken string) int {
+		r := httptest.NewRequest(http.MethodPost, "/api/refresh", nil)
+		r.AddCookie(cookies[refreshTokenCookie])
+		r.AddCookie(cookies[csrfCookie])
+		if csrfToken != "" {
+			r.Header.Set(csrfHeader, csrfToken)
+		}
+		return serve(cfg.refreshSession, r).Code
+	}
+	if status := refresh(""); status != http.StatusForbidden {
+		t.Errorf("cookie refresh without csrf header: status %d, want %d", status, http.StatusForbidden)
+	}
+	if status := refresh(cookies[csrfCookie].Value); status != http.StatusNoContent {
+		t.Errorf("cookie refresh with csrf header: status %d, want %d", status, http.StatusNoContent)
+	}
+}
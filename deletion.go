@@ -0,0 +1,153 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/mailer"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Deleting an account only marks it and logs it out everywhere. Logging in
+// again within the grace period restores it, after which purgeDeletedUsers
+// removes the user along with everything that references them.
+const defaultDeletionGracePeriod = 30 * 24 * time.Hour
+
+var errAccountDeleted = errors.New("account has been deleted")
+
+// loadDeletionGracePeriod reads ACCOUNT_DELETION_GRACE_PERIOD. It must
+// outlast access tokens, whose denylist entries are purged with the user.
+func loadDeletionGracePeriod() (time.Duration, error) {
+	value := os.Getenv("ACCOUNT_DELETION_GRACE_PERIOD")
+	if value == "" {
+		return defaultDeletionGracePeriod, nil
+	}
+
+	grace, err := time.ParseDuration(value)
+	if err != nil || grace < accessTokenDuration {
+		return 0, fmt.Errorf("invalid ACCOUNT_DELETION_GRACE_PERIOD: %q, it must be at least %s", value, accessTokenDuration)
+	}
+	return grace, nil
+}
+
+// deleteUser schedules the caller's account for deletion. The password is
+// asked for again, so accounts without one have to set it first through
+// the password reset flow.
+func (cfg *apiConfig) deleteUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	user, err := cfg.sql.GetUserByID(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+
+	if !cfg.confirmPassword(w, r, user, params.Password) {
+		return
+	}
+
+	user, err = cfg.scheduleUserDeletion(r.Context(), user.ID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't delete account")
+		return
+	}
+	cfg.clearSessionCookies(w)
+
+	purgeAt := user.DeletionRequestedAt.Time.Add(cfg.deletionGrace)
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy account will be deleted",
+		Body:    fmt.Sprintf("Your Chirpy account is scheduled for deletion on %s.\n\nIf you change your mind, log in before then and your account will be restored.\n", purgeAt.UTC().Format("January 2, 2006 15:04 MST")),
+	})
+
+	type response struct {
+		DeletionScheduledAt time.Time `json:"deletion_scheduled_at"`
+	}
+	resp := response{purgeAt}
+
+	writeSuccessJson(w, resp, http.StatusAccepted)
+}
+
+// scheduleUserDeletion marks the user for deletion and revokes every
+// credential that lets them in without logging in again.
+func (cfg *apiConfig) scheduleUserDeletion(ctx context.Context, userID uuid.UUID) (database.User, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	q := cfg.sql.WithTx(tx)
+
+	user, err := q.RequestUserDeletion(ctx, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	familyIDs, err := revokeAllCredentials(ctx, q, userID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return database.User{}, err
+	}
+
+	for _, familyID := range familyIDs {
+		err = cfg.revokeSessionAccessTokens(ctx, userID, familyID)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+	return user, nil
+}
+
+// restoreUser cancels the pending deletion of a user who logs in within the
+// grace period. It returns errAccountDeleted once the period is over.
+func (cfg *apiConfig) restoreUser(ctx context.Context, user database.User) (database.User, error) {
+	if !user.DeletionRequestedAt.Valid {
+		return user, nil
+	}
+	if time.Since(user.DeletionRequestedAt.Time) > cfg.deletionGrace {
+		return database.User{}, errAccountDeleted
+	}
+
+	log.Printf("Restoring account %s scheduled for deletion", user.ID)
+	return cfg.sql.CancelUserDeletion(ctx, user.ID)
+}
+
+func (cfg *apiConfig) purgeDeletedUsers(ctx context.Context) error {
+	purged, err := cfg.sql.PurgeDeletedUsers(ctx, time.Now().Add(-cfg.deletionGrace))
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		log.Printf("Purged %d deleted accounts", purged)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// deleteTestUser schedules the deletion of the account of session.
+func deleteTestUser(t *testing.T, cfg *apiConfig, session sessionTokens) {
+	t.Helper()
+
+	rr := serve(cfg.deleteUser, withBearer(newJSONRequest(http.MethodDelete, "/api/users", map[string]any{
+		"password": testPassword,
+	}), session.Token))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("deleting account: status %d, body %s", rr.Code, rr.Body)
+	}
+}
+
+// backdateDeletion moves the deletion request of userID back by age.
+func backdateDeletion(t *testing.T, cfg *apiConfig, userID uuid.UUID, age time.Duration) {
+	t.Helper()
+
+	_, err := cfg.db.Exec(`UPDATE users SET deletion_requested_at = NOW() - $2 * INTERVAL '1 second' WHERE id = $1`, userID, age.Seconds())
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// loginStatus logs in as email with testPassword and returns the status.
+func loginStatus(cfg *apiConfig, email string) int {
+	return serve(cfg.createSession, newJSONRequest(http.MethodPost, "/api/login", map[string]any{
+		"email":    email,
+		"password": testPassword,
+	})).Code
+}
+
+func TestDeleteUserLogsOutEverywhere(t *testing.T) {
+	cfg, mail := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+	other := loginTestUser(t, cfg, "alice@example.com")
+	pat := createTestPAT(t, cfg, session.Token, auth.ScopeChirpsRead)
+
+	rr := serve(cfg.deleteUser, withBearer(newJSONRequest(http.MethodDelete, "/api/users", map[string]any{
+		"password": "not the password",
+	}), session.Token))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	deleteTestUser(t, cfg, session)
+	if msg := mail.next(t); msg.To != "alice@example.com" {
+		t.Errorf("notice sent to %s", msg.To)
+	}
+
+	for name, token := range map[string]string{"access token": session.Token, "other session": other.Token, "personal access token": pat} {
+		_, err := cfg.authenticate(withBearer(newJSONRequest(http.MethodGet, "/api/chirps", nil), token))
+		if err == nil {
+			t.Errorf("%s still authenticates", name)
+		}
+	}
+	if _, status := refresh(cfg, other.RefreshToken); status != http.StatusUnauthorized {
+		t.Errorf("refresh: status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestLoginWithinGracePeriodRestoresAccount(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	user := createTestUser(t, cfg, "alice@example.com")
+	deleteTestUser(t, cfg, loginTestUser(t, cfg, "alice@example.com"))
+	backdateDeletion(t, cfg, user.ID, cfg.deletionGrace-time.Hour)
+
+	if status := loginStatus(cfg, "alice@example.com"); status != http.StatusOK {
+		t.Fatalf("login: status %d, want %d", status, http.StatusOK)
+	}
+
+	user, err := cfg.sql.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.DeletionRequestedAt.Valid {
+		t.Error("account is still scheduled for deletion")
+	}
+
+	// A restored account is not purged.
+	err = cfg.purgeDeletedUsers(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.sql.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Errorf("restored account: %s", err)
+	}
+}
+
+func TestLoginAfterGracePeriodFails(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	user := createTestUser(t, cfg, "alice@example.com")
+	deleteTestUser(t, cfg, loginTestUser(t, cfg, "alice@example.com"))
+	backdateDeletion(t, cfg, user.ID, cfg.deletionGrace+time.Hour)
+
+	if status := loginStatus(cfg, "alice@example.com"); status != http.StatusUnauthorized {
+		t.Fatalf("login: status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	user, err := cfg.sql.GetUserByID(context.Background(), user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !user.DeletionRequestedAt.Valid {
+		t.Error("login after the grace period restored the account")
+	}
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	ctx := context.Background()
+
+	expired := createTestUser(t, cfg, "expired@example.com")
+	deleteTestUser(t, cfg, loginTestUser(t, cfg, "expired@example.com"))
+	backdateDeletion(t, cfg, expired.ID, cfg.deletionGrace+time.Hour)
+
+	pending := createTestUser(t, cfg, "pending@example.com")
+	deleteTestUser(t, cfg, loginTestUser(t, cfg, "pending@example.com"))
+
+	active := createTestUser(t, cfg, "active@example.com")
+
+	err := cfg.purgeDeletedUsers(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cfg.sql.GetUserByID(ctx, expired.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("account past the grace period: error = %v, want %v", err, sql.ErrNoRows)
+	}
+	for _, user := range []uuid.UUID{pending.ID, active.ID} {
+		_, err = cfg.sql.GetUserByID(ctx, user)
+		if err != nil {
+			t.Errorf("account %s was purged: %s", user, err)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Sessions can be bound to a DPoP key by sending a proof with the request
+// that logs in. Their access tokens then carry the key thumbprint and are
+// sent with the DPoP scheme plus a fresh proof, and refreshing the session
+// needs a proof from the same key, so a stolen token is useless on its own.
+
+var (
+	errDPoPProofRequired = errors.New("token is bound to a dpop key, a proof is required")
+	errDPoPKeyMismatch   = errors.New("dpop proof was made with another key")
+	errDPoPUnbound       = errors.New("token is not bound to a dpop key")
+	errDPoPReplayed      = errors.New("dpop proof was already used")
+)
+
+// usesDPoPScheme reports whether r sends its token with the DPoP scheme.
+func usesDPoPScheme(r *http.Request) bool {
+	scheme, _, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	return strings.EqualFold(scheme, "dpop")
+}
+
+// requestDPoPKey verifies the DPoP proof of r, which must be bound to
+// accessToken unless that is empty, and returns the thumbprint of its key.
+// It returns an empty thumbprint for requests without a proof.
+func (cfg *apiConfig) requestDPoPKey(r *http.Request, accessToken string) (string, error) {
+	proofs := r.Header.Values(auth.DPoPHeader)
+	if len(proofs) == 0 {
+		return "", nil
+	}
+	if len(proofs) > 1 {
+		return "", fmt.Errorf("%w: more than one proof", auth.ErrInvalidDPoPProof)
+	}
+
+	now := time.Now()
+	proof, err := auth.VerifyDPoPProof(proofs[0], r.Method, cfg.baseURL+r.URL.Path, accessToken, now)
+	if err != nil {
+		return "", err
+	}
+
+	if !cfg.dpopReplay.Add(proof.Thumbprint+":"+proof.ID, proof.IssuedAt.Add(auth.DPoPProofMaxAge+time.Minute), now) {
+		return "", errDPoPReplayed
+	}
+	return proof.Thumbprint, nil
+}
+
+// checkDPoPBinding makes sure a token bound to a DPoP key comes with a
+// proof made with that key, and that only bound tokens use the DPoP scheme.
+func (cfg *apiConfig) checkDPoPBinding(r *http.Request, token string, claims *auth.Claims) error {
+	jkt := claims.DPoPThumbprint()
+	if jkt == "" {
+		if usesDPoPScheme(r) {
+			return errDPoPUnbound
+		}
+		return nil
+	}
+
+	// Bound tokens in cookies are fine without the scheme, the proof is
+	// what counts.
+	if r.Header.Get("Authorization") != "" && !usesDPoPScheme(r) {
+		return errDPoPProofRequired
+	}
+
+	proofJKT, err := cfg.requestDPoPKey(r, token)
+	if err != nil {
+		return err
+	}
+	if proofJKT == "" {
+		return errDPoPProofRequired
+	}
+	if proofJKT != jkt {
+		return errDPoPKeyMismatch
+	}
+	return nil
+}
+
+// isDPoPError reports whether err is about the DPoP proof of a request.
+func isDPoPError(err error) bool {
+	return errors.Is(err, auth.ErrInvalidDPoPProof) || errors.Is(err, errDPoPProofRequired) ||
+		errors.Is(err, errDPoPKeyMismatch) || errors.Is(err, errDPoPUnbound) || errors.Is(err, errDPoPReplayed)
+}
+
+func (cfg *apiConfig) pruneDPoPReplayCache(ctx context.Context) error {
+	cfg.dpopReplay.Prune(time.Now())
+	return nil
+}
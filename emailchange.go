@@ -0,0 +1,338 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/mailer"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// A new email only replaces the current one once a link sent to it is
+// opened. The old address is then told about the change and gets a link
+// that puts it back and locks out whoever made the change, in case the
+// account was hijacked.
+const (
+	confirmEmailChangePurpose  = "confirm-email-change"
+	revertEmailChangePurpose   = "revert-email-change"
+	emailChangeConfirmDuration = 24 * time.Hour
+	emailChangeRevertDuration  = 7 * 24 * time.Hour
+
+	// emailIndex keeps emails unique when they are checked and taken
+	// concurrently.
+	emailIndex = "users_email_key"
+)
+
+var (
+	errEmailTaken       = errors.New("email is already in use")
+	errEmailChangeStale = errors.New("email changed since the change was requested")
+)
+
+// requestEmailChange mails newEmail a link that makes it the email of user,
+// replacing any change still waiting for confirmation.
+func (cfg *apiConfig) requestEmailChange(ctx context.Context, user database.User, newEmail string) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := cfg.sql.WithTx(tx)
+
+	err = q.DeletePendingEmailChanges(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	change, err := q.CreateEmailChange(ctx, database.CreateEmailChangeParams{
+		UserID:   user.ID,
+		OldEmail: user.Email,
+		NewEmail: newEmail,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	token := auth.MakeSignedToken(cfg.secret, confirmEmailChangePurpose, change.ID.String(), emailChangeConfirmDuration)
+	link := cfg.baseURL + "/api/users/email/confirm?token=" + url.QueryEscape(token)
+	cfg.sendMail(mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new Chirpy email address",
+		Body:    fmt.Sprintf("Someone asked to use this address for their Chirpy account.\n\nTo confirm the change, open this link within the next 24 hours:\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n", link),
+	})
+	return nil
+}
+
+// confirmEmailChange makes the new email of a change the user's email and
+// tells the old address how to undo it.
+func (cfg *apiConfig) confirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	changeID, err := emailChangeFromToken(cfg.secret, confirmEmailChangePurpose, r.URL.Query().Get("token"))
+	if err != nil {
+		writeErrorJson(w, err, "Invalid or expired token")
+		return
+	}
+
+	change, user, err := cfg.applyEmailChange(r.Context(), changeID)
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, errEmailChangeStale) {
+		writeErrorJson(w, err, "Invalid or expired token")
+		return
+	}
+	if errors.Is(err, errEmailTaken) {
+		w.WriteHeader(http.StatusConflict)
+		writeErrorJson(w, err, "Email is already in use")
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	token := auth.MakeSignedToken(cfg.secret, revertEmailChangePurpose, change.ID.String(), emailChangeRevertDuration)
+	link := cfg.baseURL + "/app/revert-email/?token=" + url.QueryEscape(token)
+	cfg.sendMail(mailer.Message{
+		To:      change.OldEmail,
+		Subject: "Your Chirpy email address was changed",
+		Body:    fmt.Sprintf("The email address of your Chirpy account was changed to %s.\n\nIf you did not do this, open this link within the next 7 days to restore this address and log out everyone using your account:\n\n%s\n", change.NewEmail, link),
+	})
+
+	type response struct {
+		ID            uuid.UUID `json:"id"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+	}
+	resp := response{user.ID, user.Email, true}
+
+	writeSuccessJson(w, resp)
+}
+
+// applyEmailChange confirms a change, as long as the user still has the
+// email it was requested from and nobody took the new one since.
+func (cfg *apiConfig) applyEmailChange(ctx context.Context, changeID uuid.UUID) (database.EmailChange, database.User, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.EmailChange{}, database.User{}, err
+	}
+	defer tx.Rollback()
+
+	q := cfg.sql.WithTx(tx)
+
+	change, err := q.ConfirmEmailChange(ctx, changeID)
+	if err != nil {
+		return database.EmailChange{}, database.User{}, err
+	}
+
+	user, err := q.GetUserByID(ctx, change.UserID)
+	if err != nil {
+		return database.EmailChange{}, database.User{}, err
+	}
+	if user.Email != change.OldEmail {
+		return database.EmailChange{}, database.User{}, errEmailChangeStale
+	}
+
+	_, err = q.GetUserByEmail(ctx, change.NewEmail)
+	if err == nil {
+		return database.EmailChange{}, database.User{}, errEmailTaken
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.EmailChange{}, database.User{}, err
+	}
+
+	user, err = q.UpdateUserEmail(ctx, database.UpdateUserEmailParams{ID: user.ID, Email: change.NewEmail})
+	if uniqueViolation(err, emailIndex) {
+		return database.EmailChange{}, database.User{}, errEmailTaken
+	}
+	if err != nil {
+		return database.EmailChange{}, database.User{}, err
+	}
+
+	return change, user, tx.Commit()
+}
+
+// showEmailRevert sends revert links mailed before they pointed at the
+// confirmation page there. Mail scanners open links, so a GET never
+// reverts anything.
+func (cfg *apiConfig) showEmailRevert(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, cfg.baseURL+"/app/revert-email/?"+r.URL.RawQuery, http.StatusFound)
+}
+
+// revertEmailChange restores the old email of a confirmed change once the
+// owner confirms on the page the revert link opens. Whoever made the change
+// may know the password, so it is cleared, every session, token and data
+// export revoked and every other sign-in method removed; the owner sets a
+// new password through the password reset flow.
+func (cfg *apiConfig) revertEmailChange(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type parameters struct {
+		Token string `json:"token"`
+	}
+
+	var params parameters
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	changeID, err := emailChangeFromToken(cfg.secret, revertEmailChangePurpose, params.Token)
+	if err != nil {
+		writeErrorJson(w, err, "Invalid or expired token")
+		return
+	}
+
+	user, err := cfg.undoEmailChange(r.Context(), changeID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeErrorJson(w, err, "Invalid or expired token")
+		return
+	}
+	if errors.Is(err, errEmailTaken) {
+		w.WriteHeader(http.StatusConflict)
+		writeErrorJson(w, err, "Your old email address is now used by another account, please contact support")
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	log.Printf("Email change %s of user %s was reverted", changeID, user.ID)
+
+	type response struct {
+		ID                    uuid.UUID `json:"id"`
+		Email                 string    `json:"email"`
+		PasswordResetRequired bool      `json:"password_reset_required"`
+	}
+	resp := response{user.ID, user.Email, true}
+
+	writeSuccessJson(w, resp)
+}
+
+// undoEmailChange puts back the old email of a change and removes every way
+// into the account that could have been set up with it, along with data
+// exports whoever made the change could download. It returns
+// errEmailTaken, leaving the change as it was, if another account took the
+// old email in the meantime.
+func (cfg *apiConfig) undoEmailChange(ctx context.Context, changeID uuid.UUID) (database.User, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	q := cfg.sql.WithTx(tx)
+
+	change, err := q.RevertEmailChange(ctx, changeID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	owner, err := q.GetUserByEmail(ctx, change.OldEmail)
+	if err == nil && owner.ID != change.UserID {
+		return database.User{}, errEmailTaken
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	_, err = q.UpdateUserEmail(ctx, database.UpdateUserEmailParams{ID: change.UserID, Email: change.OldEmail})
+	if uniqueViolation(err, emailIndex) {
+		return database.User{}, errEmailTaken
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	err = q.DeletePendingEmailChanges(ctx, change.UserID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	familyIDs, err := revokeAllCredentials(ctx, q, change.UserID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	err = removeSignInMethods(ctx, q, change.UserID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	err = q.DeleteDataExportsByUserID(ctx, change.UserID)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	user, err := q.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{ID: change.UserID})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return database.User{}, err
+	}
+
+	for _, familyID := range familyIDs {
+		err = cfg.revokeSessionAccessTokens(ctx, user.ID, familyID)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+	return user, nil
+}
+
+// removeSignInMethods deletes the passkeys, linked single sign-on
+// identities, second factor and unused magic links of the user, all of which
+// a hijacker could have added to get back in.
+func removeSignInMethods(ctx context.Context, q *database.Queries, userID uuid.UUID) error {
+	err := q.DeleteWebAuthnCredentialsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = q.DeleteUserIdentitiesByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = q.DeleteUserTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = q.DeleteRecoveryCodesByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return q.DeleteMagicLinksByUserID(ctx, userID)
+}
+
+// emailChangeFromToken returns the email change a confirm or revert link
+// was made for.
+func emailChangeFromToken(secret, purpose, token string) (uuid.UUID, error) {
+	data, err := auth.VerifySignedToken(secret, purpose, token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.Parse(data)
+}
+
+func (cfg *apiConfig) pruneEmailChanges(ctx context.Context) error {
+	return cfg.sql.DeleteStaleEmailChanges(ctx, time.Now().Add(-emailChangeConfirmDuration-emailChangeRevertDuration))
+}
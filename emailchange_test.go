@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// changeEmail asks for the email of the account of session to become
+// newEmail and returns the confirm link mailed to it.
+func changeEmail(t *testing.T, cfg *apiConfig, mail *testMailer, session sessionTokens, newEmail string) string {
+	t.Helper()
+
+	rr := serve(cfg.updateUser, withBearer(newJSONRequest(http.MethodPut, "/api/users", map[string]any{
+		"email":            newEmail,
+		"password":         testPassword,
+		"current_password": testPassword,
+	}), session.Token))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("changing email: status %d, body %s", rr.Code, rr.Body)
+	}
+	return mail.link(t)
+}
+
+// confirmEmail opens a confirm link.
+func confirmEmail(cfg *apiConfig, link string) int {
+	return serve(cfg.confirmEmailChange, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(link, testBaseURL), nil)).Code
+}
+
+// revertEmail confirms a revert on the page the revert link opens.
+func revertEmail(t *testing.T, cfg *apiConfig, link string) int {
+	t.Helper()
+
+	return serve(cfg.revertEmailChange, newJSONRequest(http.MethodPost, "/api/users/email/revert", map[string]any{
+		"token": tokenQuery(t, link),
+	})).Code
+}
+
+func TestEmailChangeConfirmAndRevert(t *testing.T) {
+	cfg, mail := newTestConfig(t)
+	ctx := context.Background()
+	user := createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+
+	if status := confirmEmail(cfg, changeEmail(t, cfg, mail, session, "mallory@example.com")); status != http.StatusOK {
+		t.Fatalf("confirm: status %d, want %d", status, http.StatusOK)
+	}
+	user, err := cfg.sql.GetUserByID(ctx, user.ID)
+	if err != nil || user.Email != "mallory@example.com" {
+		t.Fatalf("after confirm: email %q, error %v", user.Email, err)
+	}
+
+	notice := mail.next(t)
+	if notice.To != "alice@example.com" {
+		t.Fatalf("notice sent to %s", notice.To)
+	}
+	link := ""
+	for _, line := range strings.Split(notice.Body, "\n") {
+		if strings.HasPrefix(line, testBaseURL+"/app/revert-email/") {
+			link = line
+		}
+	}
+	if link == "" {
+		t.Fatalf("no link to the revert page in %q", notice.Body)
+	}
+
+	// Opening the link, as mail scanners do, only shows the page.
+	rr := serve(cfg.showEmailRevert, httptest.NewRequest(http.MethodGet, "/api/users/email/revert?token="+tokenQuery(t, link), nil))
+	if rr.Code != http.StatusFound || !strings.HasPrefix(rr.Header().Get("Location"), testBaseURL+"/app/revert-email/?token=") {
+		t.Fatalf("old link: status %d, location %q", rr.Code, rr.Header().Get("Location"))
+	}
+	page := httptest.NewRecorder()
+	http.StripPrefix("/app", http.FileServer(http.Dir("."))).ServeHTTP(page, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(link, testBaseURL), nil))
+	if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), "/api/users/email/revert") {
+		t.Fatalf("revert page: status %d", page.Code)
+	}
+	user, err = cfg.sql.GetUserByID(ctx, user.ID)
+	if err != nil || user.Email != "mallory@example.com" {
+		t.Fatalf("opening the link reverted the change: email %q, error %v", user.Email, err)
+	}
+
+	// Whoever changed the email may have asked for a copy of the data.
+	export, err := cfg.sql.CreateDataExport(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := revertEmail(t, cfg, link); status != http.StatusOK {
+		t.Fatalf("revert: status %d, want %d", status, http.StatusOK)
+	}
+	user, err = cfg.sql.GetUserByID(ctx, user.ID)
+	if err != nil || user.Email != "alice@example.com" {
+		t.Fatalf("after revert: email %q, error %v", user.Email, err)
+	}
+	if _, err := cfg.authenticate(withBearer(newJSONRequest(http.MethodGet, "/api/chirps", nil), session.Token)); err == nil {
+		t.Error("session of whoever changed the email still authenticates")
+	}
+	if status := loginStatus(cfg, "alice@example.com"); status != http.StatusUnauthorized {
+		t.Errorf("old password: status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if _, err := cfg.sql.GetDataExportByID(ctx, export.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("data export: error = %v, want %v", err, sql.ErrNoRows)
+	}
+
+	if status := revertEmail(t, cfg, link); status != http.StatusBadRequest {
+		t.Errorf("second revert: status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestConfirmStaleEmailChange(t *testing.T) {
+	cfg, mail := newTestConfig(t)
+	user := createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+
+	// A new request replaces the pending one.
+	replaced := changeEmail(t, cfg, mail, session, "alice@example.org")
+	link := changeEmail(t, cfg, mail, session, "alice@example.net")
+	if status := confirmEmail(cfg, replaced); status != http.StatusBadRequest {
+		t.Errorf("replaced change: status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	// The account no longer has the email the change was requested from.
+	_, err := cfg.db.Exec(`UPDATE users SET email = 'alice@example.io' WHERE id = $1`, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := confirmEmail(cfg, link); status != http.StatusBadRequest {
+		t.Errorf("stale change: status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func TestEmailChangeToTakenEmail(t *testing.T) {
+	cfg, mail := newTestConfig(t)
+	user := createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+
+	link := changeEmail(t, cfg, mail, session, "bob@example.com")
+	createTestUser(t, cfg, "bob@example.com")
+	if status := confirmEmail(cfg, link); status != http.StatusConflict {
+		t.Errorf("confirm: status %d, want %d", status, http.StatusConflict)
+	}
+
+	user, err := cfg.sql.GetUserByID(context.Background(), user.ID)
+	if err != nil || user.Email != "alice@example.com" {
+		t.Errorf("email %q, error %v", user.Email, err)
+	}
+}
+
+func TestRevertEmailChangeToTakenEmail(t *testing.T) {
+	cfg, mail := newTestConfig(t)
+	user := createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+
+	if status := confirmEmail(cfg, changeEmail(t, cfg, mail, session, "alice@example.org")); status != http.StatusOK {
+		t.Fatalf("confirm: status %d, want %d", status, http.StatusOK)
+	}
+	link := mail.link(t)
+	createTestUser(t, cfg, "alice@example.com")
+
+	if status := revertEmail(t, cfg, link); status != http.StatusConflict {
+		t.Errorf("revert: status %d, want %d", status, http.StatusConflict)
+	}
+
+	// The change stays in place, and can be reverted once the email is free.
+	user, err := cfg.sql.GetUserByID(context.Background(), user.ID)
+	if err != nil || user.Email != "alice@example.org" {
+		t.Errorf("email %q, error %v", user.Email, err)
+	}
+	if _, err := cfg.authenticate(withBearer(newJSONRequest(http.MethodGet, "/api/chirps", nil), session.Token)); err != nil {
+		t.Errorf("failed revert logged the user out: %s", err)
+	}
+}
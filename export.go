@@ -0,0 +1,497 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/mailer"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Data exports are built in the background into a zip archive of
+// everything we hold about a user, which they download through an emailed
+// link until the export expires.
+const (
+	dataExportPurpose  = "data-export"
+	dataExportDuration = 7 * 24 * time.Hour
+	// Exports left running this long were interrupted by a restart and are
+	// built again.
+	dataExportStaleAfter = time.Hour
+	// Exports go from pending to running to ready, or failed.
+	dataExportReady = "ready"
+)
+
+type dataExportResponse struct {
+	ID          uuid.UUID  `json:"id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Status      string     `json:"status"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+func newDataExportResponse(export database.DataExport) dataExportResponse {
+	resp := dataExportResponse{ID: export.ID, CreatedAt: export.CreatedAt, Status: export.Status}
+	if export.CompletedAt.Valid {
+		resp.CompletedAt = &export.CompletedAt.Time
+	}
+	if export.ExpiresAt.Valid {
+		resp.ExpiresAt = &export.ExpiresAt.Time
+	}
+	return resp
+}
+
+// createDataExport starts an export of the caller's data. Only one export
+// per user is built at a time.
+func (cfg *apiConfig) createDataExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	active, err := cfg.sql.GetActiveDataExportByUserID(r.Context(), caller.UserID)
+	if err == nil {
+		w.WriteHeader(http.StatusConflict)
+		writeErrorJson(w, fmt.Errorf("export %s is still %s", active.ID, active.Status), "An export is already in progress")
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	export, err := cfg.sql.CreateDataExport(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't start export")
+		return
+	}
+
+	go func() {
+		err := cfg.runDataExports(context.Background())
+		if err != nil {
+			log.Printf("Error running data exports: %s", err)
+		}
+	}()
+
+	w.Header().Set("Location", "/api/users/export/"+export.ID.String())
+	writeSuccessJson(w, newDataExportResponse(export), http.StatusAccepted)
+}
+
+// showDataExport reports the progress of one of the caller's exports.
+func (cfg *apiConfig) showDataExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	exportID, err := uuid.Parse(r.PathValue("exportID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Export not found")
+		return
+	}
+
+	export, err := cfg.sql.GetDataExportByID(r.Context(), exportID)
+	if err != nil || export.UserID != caller.UserID {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Export not found")
+		return
+	}
+
+	writeSuccessJson(w, newDataExportResponse(export))
+}
+
+// downloadDataExport serves the archive of a finished export to whoever
+// holds the emailed link. A bad link and an export that is gone both get a
+// 404, so the response doesn't tell which exports exist.
+func (cfg *apiConfig) downloadDataExport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	data, err := auth.VerifySignedToken(cfg.secret, dataExportPurpose, r.URL.Query().Get("token"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Invalid or expired link")
+		return
+	}
+
+	exportID, err := uuid.Parse(data)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Invalid or expired link")
+		return
+	}
+
+	export, err := cfg.sql.GetDataExportByID(r.Context(), exportID)
+	if err != nil || export.Status != dataExportReady || !export.ExpiresAt.Valid || export.ExpiresAt.Time.Before(time.Now()) {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, fmt.Errorf("export %s is not available", exportID), "Invalid or expired link")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, export.CompletedAt.Time.Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(export.Archive)
+}
+
+// runDataExports builds pending exports until there are none left. Several
+// servers can run it at once, each export is claimed by one of them.
+func (cfg *apiConfig) runDataExports(ctx context.Context) error {
+	for {
+		export, err := cfg.sql.ClaimDataExport(ctx, time.Now().Add(-dataExportStaleAfter))
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = cfg.buildDataExport(ctx, export)
+		if err != nil {
+			log.Printf("Error building data export %s: %s", export.ID, err)
+			err = cfg.sql.FailDataExport(ctx, export.ID)
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// buildDataExport stores the archive of an export and emails its owner the
+// download link.
+func (cfg *apiConfig) buildDataExport(ctx context.Context, export database.DataExport) error {
+	user, err := cfg.sql.GetUserByID(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+
+	archive, err := cfg.dataExportArchive(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(dataExportDuration)
+	err = cfg.sql.CompleteDataExport(ctx, database.CompleteDataExportParams{
+		ID:        export.ID,
+		Archive:   archive,
+		ExpiresAt: sql.NullTime{Time: expiresAt, Valid: true},
+	})
+	if err != nil {
+		return err
+	}
+
+	token := auth.MakeSignedToken(cfg.secret, dataExportPurpose, export.ID.String(), dataExportDuration)
+	link := cfg.baseURL + "/api/users/export/download?token=" + url.QueryEscape(token)
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy data export is ready",
+		Body:    fmt.Sprintf("The copy of your Chirpy data you asked for is ready.\n\nDownload it with this link within the next 7 days:\n\n%s\n\nAnyone with the link can download your data, so don't share it.\n", link),
+	})
+	return nil
+}
+
+// dataExportArchive returns a zip of the user's profile, chirps, session
+// history, subscription, sign-in methods, API access and email changes.
+// Secrets such as token hashes and key material are left out.
+func (cfg *apiConfig) dataExportArchive(ctx context.Context, user database.User) ([]byte, error) {
+	type profile struct {
+		ID              uuid.UUID  `json:"id"`
+		CreatedAt       time.Time  `json:"created_at"`
+		UpdatedAt       time.Time  `json:"updated_at"`
+		Email           string     `json:"email"`
+		EmailVerifiedAt *time.Time `json:"email_verified_at"`
+		Handle          string     `json:"handle"`
+		DisplayName     string     `json:"display_name"`
+		Bio             string     `json:"bio"`
+		Location        string     `json:"location"`
+		Website         string     `json:"website"`
+		Role            string     `json:"role"`
+	}
+	userProfile := profile{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		Handle:      user.Handle.String,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Location:    user.Location,
+		Website:     user.Website,
+		Role:        user.Role,
+	}
+	if user.EmailVerifiedAt.Valid {
+		userProfile.EmailVerifiedAt = &user.EmailVerifiedAt.Time
+	}
+
+	chirps, err := cfg.sql.GetChirps(ctx, database.GetChirpsParams{
+		UserID: uuid.NullUUID{UUID: user.ID, Valid: true},
+		Sort:   "ASC",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	history, err := cfg.sql.GetSessionHistoryByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].CreatedAt.Before(history[j].CreatedAt) })
+
+	type session struct {
+		ID         uuid.UUID  `json:"id"`
+		ClientID   *uuid.UUID `json:"client_id,omitempty"`
+		CreatedAt  time.Time  `json:"created_at"`
+		LastUsedAt time.Time  `json:"last_used_at"`
+		ExpiresAt  time.Time  `json:"expires_at"`
+		RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+		UserAgent  string     `json:"user_agent"`
+		IPAddress  string     `json:"ip_address"`
+	}
+	sessions := []session{}
+	for _, s := range history {
+		entry := session{
+			ID:         s.FamilyID,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IpAddress,
+		}
+		if s.ClientID.Valid {
+			entry.ClientID = &s.ClientID.UUID
+		}
+		if s.RevokedAt.Valid {
+			entry.RevokedAt = &s.RevokedAt.Time
+		}
+		sessions = append(sessions, entry)
+	}
+
+	type subscription struct {
+		IsChirpyRed bool `json:"is_chirpy_red"`
+	}
+
+	signIn, err := cfg.dataExportSignIn(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	access, err := cfg.dataExportAccess(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := cfg.sql.GetEmailChangesByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	type emailChange struct {
+		CreatedAt   time.Time  `json:"created_at"`
+		OldEmail    string     `json:"old_email"`
+		NewEmail    string     `json:"new_email"`
+		ConfirmedAt *time.Time `json:"confirmed_at,omitempty"`
+		RevertedAt  *time.Time `json:"reverted_at,omitempty"`
+	}
+	emailChanges := []emailChange{}
+	for _, c := range changes {
+		emailChanges = append(emailChanges, emailChange{c.CreatedAt, c.OldEmail, c.NewEmail, nullTime(c.ConfirmedAt), nullTime(c.RevertedAt)})
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+
+	writeJSON := func(name string, v any) error {
+		f, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	err = writeJSON("profile.json", userProfile)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := archive.Create("chirps.ndjson")
+	if err != nil {
+		return nil, err
+	}
+	enc := json.NewEncoder(f)
+	for _, chirp := range chirps {
+		err = enc.Encode(struct {
+			ID        uuid.UUID `json:"id"`
+			CreatedAt time.Time `json:"created_at"`
+			UpdatedAt time.Time `json:"updated_at"`
+			Body      string    `json:"body"`
+		}{chirp.ID, chirp.CreatedAt, chirp.UpdatedAt, chirp.Body})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = writeJSON("sessions.json", sessions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeJSON("subscription.json", subscription{user.IsChirpyRed})
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeJSON("sign_in.json", signIn)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeJSON("api_access.json", access)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeJSON("email_changes.json", emailChanges)
+	if err != nil {
+		return nil, err
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// dataExportSignInMethods are the ways a user can log in besides their
+// password.
+type dataExportSignInMethods struct {
+	TwoFactor struct {
+		Enabled   bool       `json:"enabled"`
+		EnabledAt *time.Time `json:"enabled_at,omitempty"`
+	} `json:"two_factor"`
+	Identities []dataExportIdentity `json:"identities"`
+	Passkeys   []dataExportPasskey  `json:"passkeys"`
+}
+
+type dataExportIdentity struct {
+	CreatedAt time.Time `json:"created_at"`
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+}
+
+type dataExportPasskey struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func (cfg *apiConfig) dataExportSignIn(ctx context.Context, userID uuid.UUID) (dataExportSignInMethods, error) {
+	methods := dataExportSignInMethods{Identities: []dataExportIdentity{}, Passkeys: []dataExportPasskey{}}
+
+	totp, err := cfg.sql.GetUserTOTP(ctx, userID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return methods, err
+	}
+	if err == nil && totp.ConfirmedAt.Valid {
+		methods.TwoFactor.Enabled = true
+		methods.TwoFactor.EnabledAt = &totp.ConfirmedAt.Time
+	}
+
+	identities, err := cfg.sql.GetUserIdentitiesByUserID(ctx, userID)
+	if err != nil {
+		return methods, err
+	}
+	for _, i := range identities {
+		methods.Identities = append(methods.Identities, dataExportIdentity{i.CreatedAt, i.Provider, i.Subject, i.Email})
+	}
+
+	passkeys, err := cfg.sql.GetWebAuthnCredentialsByUserID(ctx, userID)
+	if err != nil {
+		return methods, err
+	}
+	for _, p := range passkeys {
+		methods.Passkeys = append(methods.Passkeys, dataExportPasskey{p.CreatedAt, p.Name, nullTime(p.LastUsedAt)})
+	}
+	return methods, nil
+}
+
+// dataExportAPIAccess is what the user has set up for programs to use
+// their account.
+type dataExportAPIAccess struct {
+	PersonalAccessTokens []dataExportToken       `json:"personal_access_tokens"`
+	OAuthClients         []dataExportOAuthClient `json:"oauth_clients"`
+}
+
+type dataExportToken struct {
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type dataExportOAuthClient struct {
+	ID           uuid.UUID `json:"id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+}
+
+func (cfg *apiConfig) dataExportAccess(ctx context.Context, userID uuid.UUID) (dataExportAPIAccess, error) {
+	access := dataExportAPIAccess{PersonalAccessTokens: []dataExportToken{}, OAuthClients: []dataExportOAuthClient{}}
+
+	pats, err := cfg.sql.GetPersonalAccessTokensByUserID(ctx, userID)
+	if err != nil {
+		return access, err
+	}
+	for _, p := range pats {
+		access.PersonalAccessTokens = append(access.PersonalAccessTokens, dataExportToken{
+			p.CreatedAt, p.Name, p.Scopes, nullTime(p.ExpiresAt), nullTime(p.LastUsedAt), nullTime(p.RevokedAt),
+		})
+	}
+
+	clients, err := cfg.sql.GetOAuthClientsByUserID(ctx, userID)
+	if err != nil {
+		return access, err
+	}
+	for _, c := range clients {
+		access.OAuthClients = append(access.OAuthClients, dataExportOAuthClient{
+			c.ID, c.CreatedAt, c.Name, c.RedirectUris, c.Scopes, c.SecretHash.Valid,
+		})
+	}
+	return access, nil
+}
+
+// nullTime is t as a pointer that is nil when t is NULL.
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func (cfg *apiConfig) pruneDataExports(ctx context.Context) error {
+	return cfg.sql.DeleteExpiredDataExports(ctx)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+// downloadExport opens the download link of an export.
+func downloadExport(cfg *apiConfig, link string) *httptest.ResponseRecorder {
+	return serve(cfg.downloadDataExport, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(link, testBaseURL), nil))
+}
+
+func TestDataExportArchive(t *testing.T) {
+	cfg, mail := newTestConfig(t)
+	ctx := context.Background()
+	user := createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+
+	rr := serve(cfg.createChirp, withBearer(newJSONRequest(http.MethodPost, "/api/chirps", map[string]any{"body": "Hello"}), session.Token))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("chirping: status %d, body %s", rr.Code, rr.Body)
+	}
+	pat := createTestPAT(t, cfg, session.Token, auth.ScopeChirpsRead)
+	_, err := cfg.sql.CreateUserIdentity(ctx, database.CreateUserIdentityParams{UserID: user.ID, Provider: "example", Subject: "alice", Email: user.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = cfg.sql.CreateEmailChange(ctx, database.CreateEmailChangeParams{UserID: user.ID, OldEmail: user.Email, NewEmail: "alice@example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr = serve(cfg.createDataExport, withBearer(newJSONRequest(http.MethodPost, "/api/users/export", nil), session.Token))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("starting export: status %d, body %s", rr.Code, rr.Body)
+	}
+	rr = downloadExport(cfg, mail.link(t))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("download: status %d, content type %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rr.Body.Bytes()), int64(rr.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = string(content)
+	}
+
+	for name, want := range map[string]string{
+		"profile.json":       `"alice@example.com"`,
+		"chirps.ndjson":      `"Hello"`,
+		"sessions.json":      `"user_agent"`,
+		"subscription.json":  `"is_chirpy_red": false`,
+		"sign_in.json":       `"provider": "example"`,
+		"api_access.json":    `"chirps:read"`,
+		"email_changes.json": `"alice@example.org"`,
+	} {
+		if !strings.Contains(files[name], want) {
+			t.Errorf("%s = %q, want it to contain %s", name, files[name], want)
+		}
+		if name != "chirps.ndjson" && !json.Valid([]byte(files[name])) {
+			t.Errorf("%s is not valid JSON", name)
+		}
+	}
+
+	// Secrets stay out of the archive.
+	for name, content := range files {
+		if strings.Contains(content, pat) || strings.Contains(content, auth.HashToken(pat)) || strings.Contains(content, user.HashedPassword) {
+			t.Errorf("%s contains a secret", name)
+		}
+	}
+}
+
+func TestDownloadDataExportNotFound(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+
+	unknown := auth.MakeSignedToken(cfg.secret, dataExportPurpose, uuid.NewString(), dataExportDuration)
+	otherPurpose := auth.MakeSignedToken(cfg.secret, "password-reset", uuid.NewString(), dataExportDuration)
+	for name, token := range map[string]string{
+		"missing token":  "",
+		"forged token":   "not-a-token",
+		"other purpose":  otherPurpose,
+		"unknown export": unknown,
+	} {
+		rr := downloadExport(cfg, "/api/users/export/download?token="+url.QueryEscape(token))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want %d", name, rr.Code, http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Package account validates the fields users set on their account, both
+// when they are sent whole and as a JSON merge patch.
+package account
+
+import (
+	"net/mail"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Handles are unique regardless of case, but are shown the way their owner
+// typed them. They never contain a dash, so they can't be confused with the
+// UUIDs that also identify users in URLs.
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// reservedHandles could pass for the service itself, or clash with routes
+// under /api/users. New routes there need their name added here.
+var reservedHandles = []string{
+	"admin", "administrator", "chirpy", "moderator", "root", "support", "system",
+	"2fa", "email", "export", "profile", "verify",
+}
+
+// Limits of the free text profile fields, in characters.
+const (
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 160
+	MaxLocationLength    = 50
+	MaxWebsiteLength     = 200
+)
+
+// ValidEmail reports whether email is a bare address such as
+// "user@example.com", without a display name.
+func ValidEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+// ValidPassword reports whether password may be set as a new password.
+func ValidPassword(password string) bool {
+	return password != ""
+}
+
+// ValidHandle reports whether handle may be claimed by a user.
+func ValidHandle(handle string) bool {
+	return handlePattern.MatchString(handle) && !slices.Contains(reservedHandles, strings.ToLower(handle))
+}
+
+// ValidWebsite reports whether website is an absolute http(s) URL.
+func ValidWebsite(website string) bool {
+	u, err := url.Parse(website)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && len(website) <= MaxWebsiteLength
+}
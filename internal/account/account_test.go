@@ -0,0 +1,77 @@
+package account
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidEmail(t *testing.T) {
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"user@example.com", true},
+		{"first.last+tag@sub.example.com", true},
+		{"user", false},
+		{"user@", false},
+		{"User <user@example.com>", false},
+		{" user@example.com", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidEmail(tt.email); got != tt.want {
+			t.Errorf("ValidEmail(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestValidHandle(t *testing.T) {
+	tests := []struct {
+		handle string
+		want   bool
+	}{
+		{"alice", true},
+		{"Alice_99", true},
+		{"abc", true},
+		{strings.Repeat("a", 30), true},
+		{"ab", false},
+		{strings.Repeat("a", 31), false},
+		{"al-ice", false},
+		{"al ice", false},
+		{"élise", false},
+		{"admin", false},
+		{"Support", false},
+		{"verify", false},
+		{"EXPORT", false},
+		{"2fa", false},
+		{"profile", false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidHandle(tt.handle); got != tt.want {
+			t.Errorf("ValidHandle(%q) = %v, want %v", tt.handle, got, tt.want)
+		}
+	}
+}
+
+func TestValidWebsite(t *testing.T) {
+	tests := []struct {
+		website string
+		want    bool
+	}{
+		{"https://example.com", true},
+		{"http://example.com/about?x=1", true},
+		{"example.com", false},
+		{"ftp://example.com", false},
+		{"javascript:alert(1)", false},
+		{"https://", false},
+		{"https://example.com/" + strings.Repeat("a", MaxWebsiteLength), false},
+	}
+
+	for _, tt := range tests {
+		if got := ValidWebsite(tt.website); got != tt.want {
+			t.Errorf("ValidWebsite(%q) = %v, want %v", tt.website, got, tt.want)
+		}
+	}
+}
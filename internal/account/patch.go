@@ -0,0 +1,113 @@
+package account
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Patch is a validated JSON merge patch (RFC 7396) of an account. Fields
+// left out of the patch are nil. Text fields are trimmed, except for the
+// passwords.
+type Patch struct {
+	// Email is only set when it differs from the current email.
+	Email    *string
+	Password *string
+	// CurrentPassword proves the caller may change the email or password.
+	CurrentPassword string
+
+	// An empty Handle releases the current one, and the other profile
+	// fields are cleared by an empty string or null alike.
+	Handle      *string
+	DisplayName *string
+	Bio         *string
+	Location    *string
+	Website     *string
+}
+
+// ChangesCredentials reports whether p changes the email or password.
+func (p Patch) ChangesCredentials() bool {
+	return p.Email != nil || p.Password != nil
+}
+
+// ChangesProfile reports whether p names any of the public profile fields.
+func (p Patch) ChangesProfile() bool {
+	return p.Handle != nil || p.DisplayName != nil || p.Bio != nil || p.Location != nil || p.Website != nil
+}
+
+// ParsePatch validates the members of a merge patch of the account whose
+// email is currentEmail. It returns what is wrong with each invalid member,
+// keyed by its name, rather than stopping at the first one. Whether a new
+// email or handle is still free is left to the caller.
+func ParsePatch(patch map[string]json.RawMessage, currentEmail string) (Patch, map[string]string) {
+	var p Patch
+	fieldErrors := map[string]string{}
+
+	for field, raw := range patch {
+		// A null member removes the field, which only profile fields allow.
+		var value *string
+		if json.Unmarshal(raw, &value) != nil {
+			fieldErrors[field] = "must be a string"
+			continue
+		}
+		text := ""
+		if value != nil {
+			text = strings.TrimSpace(*value)
+		}
+
+		switch field {
+		case "email":
+			if !ValidEmail(text) {
+				fieldErrors[field] = "must be a valid email address"
+			} else if text != currentEmail {
+				p.Email = &text
+			}
+		case "password":
+			if value == nil || !ValidPassword(*value) {
+				fieldErrors[field] = "must not be empty"
+			} else {
+				p.Password = value
+			}
+		case "current_password":
+			if value != nil {
+				p.CurrentPassword = *value
+			}
+		case "handle":
+			if text != "" && !ValidHandle(text) {
+				fieldErrors[field] = "must be 3 to 30 letters, digits or underscores"
+			} else {
+				p.Handle = &text
+			}
+		case "display_name":
+			p.DisplayName = limitText(fieldErrors, field, text, MaxDisplayNameLength)
+		case "bio":
+			p.Bio = limitText(fieldErrors, field, text, MaxBioLength)
+		case "location":
+			p.Location = limitText(fieldErrors, field, text, MaxLocationLength)
+		case "website":
+			if text != "" && !ValidWebsite(text) {
+				fieldErrors[field] = "must be an http or https URL"
+			} else {
+				p.Website = &text
+			}
+		default:
+			fieldErrors[field] = "is not a known field"
+		}
+	}
+
+	if p.ChangesCredentials() && p.CurrentPassword == "" {
+		fieldErrors["current_password"] = "is required to change the email or password"
+	}
+	return p, fieldErrors
+}
+
+// limitText returns text, or records an error for field if it is longer
+// than limit characters.
+func limitText(fieldErrors map[string]string, field, text string, limit int) *string {
+	if utf8.RuneCountInString(text) > limit {
+		fieldErrors[field] = fmt.Sprintf("must be at most %d characters", limit)
+		return nil
+	}
+	return &text
+}
@@ -0,0 +1,142 @@
+package account
+
+import (
+	"encoding/json"
+	"maps"
+	"strings"
+	"testing"
+)
+
+func ptr(s string) *string {
+	return &s
+}
+
+func TestParsePatch(t *testing.T) {
+	const currentEmail = "old@example.com"
+
+	tests := []struct {
+		name       string
+		patch      string
+		want       Patch
+		wantErrors map[string]string
+	}{
+		{
+			name:  "profile fields",
+			patch: `{"handle": " alice ", "display_name": "Alice", "bio": "", "location": null, "website": "https://alice.dev"}`,
+			want: Patch{
+				Handle:      ptr("alice"),
+				DisplayName: ptr("Alice"),
+				Bio:         ptr(""),
+				Location:    ptr(""),
+				Website:     ptr("https://alice.dev"),
+			},
+		},
+		{
+			name:  "null handle releases it",
+			patch: `{"handle": null}`,
+			want:  Patch{Handle: ptr("")},
+		},
+		{
+			name:  "new email and password",
+			patch: `{"email": "new@example.com", "password": " secret ", "current_password": "old"}`,
+			want:  Patch{Email: ptr("new@example.com"), Password: ptr(" secret "), CurrentPassword: "old"},
+		},
+		{
+			name:  "unchanged email",
+			patch: `{"email": "old@example.com"}`,
+			want:  Patch{},
+		},
+		{
+			name:       "credentials without current password",
+			patch:      `{"password": "secret"}`,
+			want:       Patch{Password: ptr("secret")},
+			wantErrors: map[string]string{"current_password": "is required to change the email or password"},
+		},
+		{
+			name:  "every invalid field is reported",
+			patch: `{"email": "nope", "password": "", "handle": "a-b", "display_name": "` + strings.Repeat("x", MaxDisplayNameLength+1) + `", "website": "ftp://x", "bio": 1, "nickname": "x"}`,
+			want:  Patch{},
+			wantErrors: map[string]string{
+				"email":        "must be a valid email address",
+				"password":     "must not be empty",
+				"handle":       "must be 3 to 30 letters, digits or underscores",
+				"display_name": "must be at most 50 characters",
+				"website":      "must be an http or https URL",
+				"bio":          "must be a string",
+				"nickname":     "is not a known field",
+			},
+		},
+		{
+			name:       "null password",
+			patch:      `{"password": null, "current_password": "old"}`,
+			want:       Patch{CurrentPassword: "old"},
+			wantErrors: map[string]string{"password": "must not be empty"},
+		},
+		{
+			name:       "reserved handle",
+			patch:      `{"handle": "Admin"}`,
+			want:       Patch{},
+			wantErrors: map[string]string{"handle": "must be 3 to 30 letters, digits or underscores"},
+		},
+		{
+			name:  "length is counted in characters",
+			patch: `{"location": "` + strings.Repeat("é", MaxLocationLength) + `"}`,
+			want:  Patch{Location: ptr(strings.Repeat("é", MaxLocationLength))},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var patch map[string]json.RawMessage
+			err := json.Unmarshal([]byte(tt.patch), &patch)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, gotErrors := ParsePatch(patch, currentEmail)
+			if !equalPatch(got, tt.want) {
+				t.Errorf("ParsePatch() = %+v, want %+v", got, tt.want)
+			}
+			if tt.wantErrors == nil {
+				tt.wantErrors = map[string]string{}
+			}
+			if !maps.Equal(gotErrors, tt.wantErrors) {
+				t.Errorf("ParsePatch() errors = %v, want %v", gotErrors, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestPatchChanges(t *testing.T) {
+	tests := []struct {
+		name        string
+		patch       Patch
+		credentials bool
+		profile     bool
+	}{
+		{"empty", Patch{}, false, false},
+		{"current password only", Patch{CurrentPassword: "x"}, false, false},
+		{"email", Patch{Email: ptr("a@b.co")}, true, false},
+		{"password", Patch{Password: ptr("x")}, true, false},
+		{"released handle", Patch{Handle: ptr("")}, false, true},
+		{"website", Patch{Website: ptr("")}, false, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.patch.ChangesCredentials(); got != tt.credentials {
+			t.Errorf("%s: ChangesCredentials() = %v, want %v", tt.name, got, tt.credentials)
+		}
+		if got := tt.patch.ChangesProfile(); got != tt.profile {
+			t.Errorf("%s: ChangesProfile() = %v, want %v", tt.name, got, tt.profile)
+		}
+	}
+}
+
+func equalPatch(a, b Patch) bool {
+	equal := func(x, y *string) bool {
+		return (x == nil) == (y == nil) && (x == nil || *x == *y)
+	}
+	return equal(a.Email, b.Email) && equal(a.Password, b.Password) && a.CurrentPassword == b.CurrentPassword &&
+		equal(a.Handle, b.Handle) && equal(a.DisplayName, b.DisplayName) && equal(a.Bio, b.Bio) &&
+		equal(a.Location, b.Location) && equal(a.Website, b.Website)
+}
@@ -4,56 +4,221 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func HashPassword(password string) (string, error) {
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(passwordHash), nil
+const (
+	// Issuer is the iss claim of every token Chirpy signs.
+	Issuer = "chirpy"
+	// AccessTokenAudience is the aud claim of access tokens accepted by the API.
+	AccessTokenAudience = "chirpy-api"
+	// ChallengeTokenAudience is the aud claim of the tokens handed out
+	// between the password and the second factor step of a login.
+	ChallengeTokenAudience = "chirpy-2fa"
+)
+
+// MakeJWT returns an access token for the login session sessionID of
+// userID, carrying the user's role.
+func MakeJWT(userID, sessionID uuid.UUID, role string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	claims := Claims{SessionID: sessionID.String(), Role: role}
+	return makeJWT(claims, userID, keys, AccessTokenAudience, expiresIn)
 }
 
-func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+// MakeBoundJWT is MakeJWT for a token bound to the DPoP key with thumbprint
+// jkt, which is only accepted along with a proof made with that key.
+func MakeBoundJWT(userID, sessionID uuid.UUID, role, jkt string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	claims := Claims{SessionID: sessionID.String(), Role: role, Confirmation: &Confirmation{JKT: jkt}}
+	return makeJWT(claims, userID, keys, AccessTokenAudience, expiresIn)
 }
 
-func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
+// MakeDelegatedJWT returns an access token that lets clientID act for
+// userID within scopes only, as granted through OAuth. It carries no role,
+// so the client never gets the user's privileges.
+func MakeDelegatedJWT(userID, clientID, sessionID uuid.UUID, scopes []string, keys *Keyring, expiresIn time.Duration) (string, error) {
+	claims := Claims{SessionID: sessionID.String(), Scope: strings.Join(scopes, " "), ClientID: clientID.String()}
+	return makeJWT(claims, userID, keys, AccessTokenAudience, expiresIn)
+}
+
+// MakeChallengeJWT returns a token proving that userID passed the password
+// check. It is only accepted with ChallengeTokenOptions.
+func MakeChallengeJWT(userID uuid.UUID, keys *Keyring, expiresIn time.Duration) (string, error) {
+	return makeJWT(Claims{}, userID, keys, ChallengeTokenAudience, expiresIn)
+}
+
+func makeJWT(claims Claims, userID uuid.UUID, keys *Keyring, audience string, expiresIn time.Duration) (string, error) {
 	timeNow := time.Now().UTC()
 	issuedAt := jwt.NewNumericDate(timeNow)
 	expiresAt := jwt.NewNumericDate(timeNow.Add(expiresIn))
-	jwtToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
-		Issuer: "chirpy", IssuedAt: issuedAt, ExpiresAt: expiresAt, Subject: userID.String(),
-	})
-	return jwtToken.SignedString([]byte(tokenSecret))
+	key := keys.SigningKey()
+	claims.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer: Issuer, Audience: jwt.ClaimStrings{audience}, IssuedAt: issuedAt, ExpiresAt: expiresAt, Subject: userID.String(),
+		ID: uuid.NewString(),
+	}
+	jwtToken := jwt.NewWithClaims(key.Method, claims)
+	jwtToken.Header["kid"] = key.ID
+	return jwtToken.SignedString(key.signKey)
+}
+
+// ValidationOptions pins down which tokens ValidateJWT accepts on top of a
+// valid signature.
+type ValidationOptions struct {
+	// Issuer is the required iss claim. Empty skips the check.
+	Issuer string
+	// Audiences lists accepted aud values; the token must carry at least one.
+	Audiences []string
+	// Algorithms lists accepted alg header values. Empty accepts whatever
+	// algorithm the matching key uses.
+	Algorithms []string
+	// Leeway is the clock skew tolerated for exp, nbf and iat.
+	Leeway time.Duration
+	// RequiredClaims lists registered claims that must be present, e.g. "exp".
+	RequiredClaims []string
+}
+
+// AccessTokenOptions returns the options used for access tokens signed with keys.
+func AccessTokenOptions(keys *Keyring) ValidationOptions {
+	return ValidationOptions{
+		Issuer:         Issuer,
+		Audiences:      []string{AccessTokenAudience},
+		Algorithms:     keys.Algorithms(),
+		Leeway:         30 * time.Second,
+		RequiredClaims: []string{"exp", "iat", "sub", "jti"},
+	}
+}
+
+// Claims are the validated claims of a Chirpy access token.
+type Claims struct {
+	jwt.RegisteredClaims
+
+	// Scope is the space separated list of scopes of a delegated token.
+	Scope string `json:"scope,omitempty"`
+	// ClientID is the OAuth client a delegated token was issued to. It is
+	// empty for tokens from a regular login.
+	ClientID string `json:"client_id,omitempty"`
+	// Role is the role of the user when a login session token was issued.
+	Role string `json:"role,omitempty"`
+	// SessionID identifies the refresh token family the token was issued
+	// with, so that revoking the session can revoke the token too.
+	SessionID string `json:"sid,omitempty"`
+	// Confirmation binds the token to a DPoP key.
+	Confirmation *Confirmation `json:"cnf,omitempty"`
+
+	userID uuid.UUID
+}
+
+// Confirmation is the cnf claim of a sender-constrained token (RFC 7800).
+type Confirmation struct {
+	// JKT is the thumbprint of the DPoP key the token is bound to.
+	JKT string `json:"jkt"`
+}
+
+// UserID returns the user the token was issued to.
+func (c *Claims) UserID() uuid.UUID {
+	return c.userID
+}
+
+// Delegated reports whether the token was issued to an OAuth client.
+func (c *Claims) Delegated() bool {
+	return c.ClientID != ""
+}
+
+// DPoPThumbprint returns the thumbprint of the DPoP key the token is bound
+// to, or an empty string for a bearer token.
+func (c *Claims) DPoPThumbprint() string {
+	if c.Confirmation == nil {
+		return ""
+	}
+	return c.Confirmation.JKT
 }
 
-func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(tokenSecret), nil
-	})
+// Scopes returns the scopes of a delegated token.
+func (c *Claims) Scopes() []string {
+	return ParseScope(c.Scope)
+}
+
+// ChallengeTokenOptions returns the options used for login challenge tokens.
+func ChallengeTokenOptions(keys *Keyring) ValidationOptions {
+	opts := AccessTokenOptions(keys)
+	opts.Audiences = []string{ChallengeTokenAudience}
+	return opts
+}
+
+func ValidateJWT(tokenString string, keys *Keyring, opts ValidationOptions) (uuid.UUID, error) {
+	claims, err := ParseJWT(tokenString, keys, opts)
 	if err != nil {
 		return uuid.Nil, err
 	}
+	return claims.UserID(), nil
+}
+
+// ParseJWT validates tokenString like ValidateJWT and returns all of its claims.
+func ParseJWT(tokenString string, keys *Keyring, opts ValidationOptions) (*Claims, error) {
+	parserOptions := []jwt.ParserOption{jwt.WithLeeway(opts.Leeway), jwt.WithIssuedAt()}
+	if opts.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(opts.Issuer))
+	}
+	if len(opts.Audiences) > 0 {
+		parserOptions = append(parserOptions, jwt.WithAudience(opts.Audiences...))
+	}
+	if len(opts.Algorithms) > 0 {
+		parserOptions = append(parserOptions, jwt.WithValidMethods(opts.Algorithms))
+	}
 
-	subject, err := token.Claims.GetSubject()
+	claims := &Claims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q for key %q", token.Method.Alg(), kid)
+		}
+		return key.verifyKey, nil
+	}, parserOptions...)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
 
-	decodedUUID, err := uuid.Parse(subject)
+	for _, name := range opts.RequiredClaims {
+		if !hasClaim(&claims.RegisteredClaims, name) {
+			return nil, fmt.Errorf("%w: %s", jwt.ErrTokenRequiredClaimMissing, name)
+		}
+	}
+
+	claims.userID, err = uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.Nil, err
+		return nil, err
 	}
 
-	return decodedUUID, nil
+	return claims, nil
+}
+
+func hasClaim(claims *jwt.RegisteredClaims, name string) bool {
+	switch name {
+	case "iss":
+		return claims.Issuer != ""
+	case "sub":
+		return claims.Subject != ""
+	case "aud":
+		return len(claims.Audience) > 0
+	case "exp":
+		return claims.ExpiresAt != nil
+	case "nbf":
+		return claims.NotBefore != nil
+	case "iat":
+		return claims.IssuedAt != nil
+	case "jti":
+		return claims.ID != ""
+	default:
+		return false
+	}
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
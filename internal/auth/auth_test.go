@@ -1,10 +1,12 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 	"testing"
 	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 )
 
@@ -24,12 +26,38 @@ func TestPasswordHashing(t *testing.T) {
 
 func TestJWT(t *testing.T) {
 	userID := uuid.New()
-	tokenSecret := "secret"
-	jwt, err := MakeJWT(userID, tokenSecret, 5*time.Minute)
+	keys, err := NewKeyring(NewHMACKey("test", []byte("secret")))
 	if err != nil {
 		t.Fatal(err)
 	}
-	decodedUUID, err := ValidateJWT(jwt, tokenSecret)
+	jwt, err := MakeJWT(userID, uuid.New(), RoleUser, keys, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decodedUUID, err := ValidateJWT(jwt, keys, AccessTokenOptions(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decodedUUID != userID {
+		t.Fatalf("UUID does not match")
+	}
+}
+
+func TestChallengeJWT(t *testing.T) {
+	userID := uuid.New()
+	keys, err := NewKeyring(NewHMACKey("test", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge, err := MakeChallengeJWT(userID, keys, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(challenge, keys, AccessTokenOptions(keys)); err == nil {
+		t.Fatal("challenge token accepted as access token")
+	}
+	decodedUUID, err := ValidateJWT(challenge, keys, ChallengeTokenOptions(keys))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -38,6 +66,173 @@ func TestJWT(t *testing.T) {
 	}
 }
 
+func TestValidateJWTRejects(t *testing.T) {
+	keys, err := NewKeyring(NewHMACKey("test", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewKeyring(NewHMACKey("test", []byte("other secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := AccessTokenOptions(keys)
+
+	now := time.Now()
+	valid := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    Issuer,
+			Audience:  jwt.ClaimStrings{AccessTokenAudience},
+			Subject:   uuid.NewString(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			ID:        uuid.NewString(),
+		}
+	}
+	sign := func(keys *Keyring, method jwt.SigningMethod, kid string, claims jwt.RegisteredClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(keys.SigningKey().signKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	with := func(change func(*jwt.RegisteredClaims)) string {
+		claims := valid()
+		change(&claims)
+		return sign(keys, jwt.SigningMethodHS256, "test", claims)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		opts    ValidationOptions
+		wantErr error
+	}{
+		{
+			name:    "malformed",
+			token:   "not.a.jwt",
+			opts:    opts,
+			wantErr: jwt.ErrTokenMalformed,
+		},
+		{
+			name:    "bad signature",
+			token:   sign(other, jwt.SigningMethodHS256, "test", valid()),
+			opts:    opts,
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "unknown kid",
+			token:   sign(keys, jwt.SigningMethodHS256, "missing", valid()),
+			opts:    opts,
+			wantErr: jwt.ErrTokenUnverifiable,
+		},
+		{
+			name:    "algorithm not allowed",
+			token:   sign(keys, jwt.SigningMethodHS512, "test", valid()),
+			opts:    opts,
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "wrong issuer",
+			token:   with(func(c *jwt.RegisteredClaims) { c.Issuer = "someone-else" }),
+			opts:    opts,
+			wantErr: jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			name:    "wrong audience",
+			token:   with(func(c *jwt.RegisteredClaims) { c.Audience = jwt.ClaimStrings{"chirpy-2fa"} }),
+			opts:    opts,
+			wantErr: jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name:    "missing audience",
+			token:   with(func(c *jwt.RegisteredClaims) { c.Audience = nil }),
+			opts:    opts,
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:    "expired beyond leeway",
+			token:   with(func(c *jwt.RegisteredClaims) { c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute)) }),
+			opts:    opts,
+			wantErr: jwt.ErrTokenExpired,
+		},
+		{
+			name:    "issued in the future",
+			token:   with(func(c *jwt.RegisteredClaims) { c.IssuedAt = jwt.NewNumericDate(now.Add(time.Minute)) }),
+			opts:    opts,
+			wantErr: jwt.ErrTokenUsedBeforeIssued,
+		},
+		{
+			name:    "not valid yet",
+			token:   with(func(c *jwt.RegisteredClaims) { c.NotBefore = jwt.NewNumericDate(now.Add(time.Minute)) }),
+			opts:    opts,
+			wantErr: jwt.ErrTokenNotValidYet,
+		},
+		{
+			name:    "missing expiry",
+			token:   with(func(c *jwt.RegisteredClaims) { c.ExpiresAt = nil }),
+			opts:    opts,
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:    "missing subject",
+			token:   with(func(c *jwt.RegisteredClaims) { c.Subject = "" }),
+			opts:    opts,
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:    "missing token id",
+			token:   with(func(c *jwt.RegisteredClaims) { c.ID = "" }),
+			opts:    opts,
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:    "subject is not a user id",
+			token:   with(func(c *jwt.RegisteredClaims) { c.Subject = "admin" }),
+			opts:    opts,
+			wantErr: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateJWT(tt.token, keys, tt.opts)
+			if err == nil {
+				t.Fatal("token was accepted")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateJWTLeeway(t *testing.T) {
+	keys, err := NewKeyring(NewHMACKey("test", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    Issuer,
+		Audience:  jwt.ClaimStrings{AccessTokenAudience},
+		Subject:   uuid.NewString(),
+		IssuedAt:  jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-10 * time.Second)),
+		ID:        uuid.NewString(),
+	})
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(keys.SigningKey().signKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ValidateJWT(signed, keys, AccessTokenOptions(keys)); err != nil {
+		t.Fatalf("token within leeway rejected: %v", err)
+	}
+}
+
 func TestGetBearerToken(t *testing.T) {
 	headers := http.Header{}
 	headers.Add("Authorization", "bearer TOKEN_STRING")
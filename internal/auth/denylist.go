@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevokedToken is a denylisted access token id and the time the token
+// would have expired anyway.
+type RevokedToken struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+// DenylistStore persists revoked access token ids so every instance sees them.
+type DenylistStore interface {
+	AddRevokedToken(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error
+	RevokedTokensSince(ctx context.Context, since time.Time) ([]RevokedToken, error)
+	PruneRevokedTokens(ctx context.Context, before time.Time) error
+}
+
+// syncOverlap is how far back each Sync looks past the previous one, so
+// rows committed while the previous Sync was running are not missed.
+const syncOverlap = 5 * time.Second
+
+// Denylist is an in-memory copy of the revoked access tokens in a
+// DenylistStore. IsRevoked never touches the store; tokens revoked on other
+// instances show up after the next Sync.
+type Denylist struct {
+	store DenylistStore
+
+	mu       sync.RWMutex
+	entries  map[string]time.Time
+	syncedAt time.Time
+}
+
+func NewDenylist(store DenylistStore) *Denylist {
+	return &Denylist{store: store, entries: map[string]time.Time{}}
+}
+
+// Revoke denylists the token until expiresAt.
+func (d *Denylist) Revoke(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error {
+	err := d.store.AddRevokedToken(ctx, jti, userID, expiresAt)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.entries[jti] = expiresAt
+	d.mu.Unlock()
+	return nil
+}
+
+// IsRevoked reports whether the token id has been denylisted.
+func (d *Denylist) IsRevoked(jti string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.entries[jti]
+	return ok
+}
+
+// Sync loads the tokens revoked since the previous Sync from the store.
+func (d *Denylist) Sync(ctx context.Context) error {
+	d.mu.RLock()
+	since := d.syncedAt
+	d.mu.RUnlock()
+
+	now := time.Now()
+	if !since.IsZero() {
+		since = since.Add(-syncOverlap)
+	}
+
+	tokens, err := d.store.RevokedTokensSince(ctx, since)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, token := range tokens {
+		d.entries[token.ID] = token.ExpiresAt
+	}
+	d.syncedAt = now
+	return nil
+}
+
+// Prune forgets tokens that have expired by now, both locally and in the
+// store; an expired token is rejected by ValidateJWT regardless.
+func (d *Denylist) Prune(ctx context.Context, now time.Time) error {
+	d.mu.Lock()
+	for jti, expiresAt := range d.entries {
+		if !expiresAt.After(now) {
+			delete(d.entries, jti)
+		}
+	}
+	d.mu.Unlock()
+
+	return d.store.PruneRevokedTokens(ctx, now)
+}
+
+// Run syncs and prunes the denylist every interval until ctx is done.
+func (d *Denylist) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Sync(ctx); err != nil {
+				log.Printf("Error syncing token denylist: %s", err)
+			}
+			if err := d.Prune(ctx, time.Now()); err != nil {
+				log.Printf("Error pruning token denylist: %s", err)
+			}
+		}
+	}
+}
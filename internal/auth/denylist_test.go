@@ -0,0 +1,99 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type memoryDenylistStore struct {
+	tokens  []RevokedToken
+	created []time.Time
+}
+
+func (s *memoryDenylistStore) AddRevokedToken(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error {
+	s.tokens = append(s.tokens, RevokedToken{ID: jti, ExpiresAt: expiresAt})
+	s.created = append(s.created, time.Now())
+	return nil
+}
+
+func (s *memoryDenylistStore) RevokedTokensSince(ctx context.Context, since time.Time) ([]RevokedToken, error) {
+	var tokens []RevokedToken
+	for i, token := range s.tokens {
+		if !s.created[i].Before(since) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (s *memoryDenylistStore) PruneRevokedTokens(ctx context.Context, before time.Time) error {
+	var tokens []RevokedToken
+	var created []time.Time
+	for i, token := range s.tokens {
+		if token.ExpiresAt.After(before) {
+			tokens = append(tokens, token)
+			created = append(created, s.created[i])
+		}
+	}
+	s.tokens, s.created = tokens, created
+	return nil
+}
+
+func TestDenylist(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryDenylistStore{}
+	expiresAt := time.Now().Add(time.Hour)
+
+	local := NewDenylist(store)
+	if err := local.Revoke(ctx, "local", uuid.New(), expiresAt); err != nil {
+		t.Fatal(err)
+	}
+	if !local.IsRevoked("local") {
+		t.Fatal("token revoked on this instance is not denylisted")
+	}
+
+	// A second instance only learns about the token through the store.
+	remote := NewDenylist(store)
+	if remote.IsRevoked("local") {
+		t.Fatal("token denylisted before sync")
+	}
+	if err := remote.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !remote.IsRevoked("local") {
+		t.Fatal("token revoked on another instance is not denylisted after sync")
+	}
+	if remote.IsRevoked("other") {
+		t.Fatal("unrelated token is denylisted")
+	}
+}
+
+func TestDenylistPrune(t *testing.T) {
+	ctx := context.Background()
+	store := &memoryDenylistStore{}
+	denylist := NewDenylist(store)
+	now := time.Now()
+
+	if err := denylist.Revoke(ctx, "expired", uuid.New(), now.Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := denylist.Revoke(ctx, "live", uuid.New(), now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := denylist.Prune(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if denylist.IsRevoked("expired") {
+		t.Fatal("expired token was not pruned")
+	}
+	if !denylist.IsRevoked("live") {
+		t.Fatal("live token was pruned")
+	}
+	if len(store.tokens) != 1 {
+		t.Fatalf("store holds %d tokens, want 1", len(store.tokens))
+	}
+}
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DPoP (RFC 9449) binds access tokens to a key held by the client. Every
+// request then carries a proof, a short lived JWT signed with that key.
+const (
+	DPoPHeader = "DPoP"
+	dpopType   = "dpop+jwt"
+	// DPoPProofMaxAge is how old a proof may be. Proofs are meant to be made
+	// right before each request, so replayed ones are only remembered this
+	// long.
+	DPoPProofMaxAge = 5 * time.Minute
+	dpopClockSkew   = time.Minute
+)
+
+var ErrInvalidDPoPProof = errors.New("invalid dpop proof")
+
+// DPoPProof is a verified DPoP proof.
+type DPoPProof struct {
+	ID string
+	// Thumbprint is the RFC 7638 thumbprint of the proof key, which bound
+	// tokens carry as their cnf.jkt claim.
+	Thumbprint string
+	IssuedAt   time.Time
+}
+
+type dpopClaims struct {
+	ID          string           `json:"jti"`
+	Method      string           `json:"htm"`
+	URI         string           `json:"htu"`
+	IssuedAt    *jwt.NumericDate `json:"iat"`
+	AccessToken string           `json:"ath"`
+}
+
+func (c dpopClaims) GetExpirationTime() (*jwt.NumericDate, error) { return nil, nil }
+func (c dpopClaims) GetIssuedAt() (*jwt.NumericDate, error)       { return c.IssuedAt, nil }
+func (c dpopClaims) GetNotBefore() (*jwt.NumericDate, error)      { return nil, nil }
+func (c dpopClaims) GetIssuer() (string, error)                   { return "", nil }
+func (c dpopClaims) GetSubject() (string, error)                  { return "", nil }
+func (c dpopClaims) GetAudience() (jwt.ClaimStrings, error)       { return nil, nil }
+
+// VerifyDPoPProof checks a proof sent with a request for method and uri at
+// time now. accessToken is the token the proof must be bound to, or empty
+// for a proof sent to obtain a token. Callers must reject proofs whose ID
+// they have seen before, see ReplayCache.
+func VerifyDPoPProof(proof, method, uri, accessToken string, now time.Time) (DPoPProof, error) {
+	var thumbprint string
+	claims := &dpopClaims{}
+	_, err := jwt.ParseWithClaims(proof, claims, func(token *jwt.Token) (any, error) {
+		if typ, _ := token.Header["typ"].(string); typ != dpopType {
+			return nil, errors.New("wrong typ")
+		}
+		jwk, ok := token.Header["jwk"].(map[string]any)
+		if !ok {
+			return nil, errors.New("missing jwk")
+		}
+		key, tp, err := parseDPoPKey(jwk)
+		if err != nil {
+			return nil, err
+		}
+		thumbprint = tp
+		return key, nil
+	},
+		jwt.WithValidMethods([]string{"ES256", "ES384", "RS256", "PS256", "EdDSA"}),
+		jwt.WithoutClaimsValidation(),
+	)
+	if err != nil {
+		return DPoPProof{}, fmt.Errorf("%w: %w", ErrInvalidDPoPProof, err)
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return DPoPProof{}, fmt.Errorf("%w: missing claims", ErrInvalidDPoPProof)
+	}
+	if claims.Method != method {
+		return DPoPProof{}, fmt.Errorf("%w: htm does not match", ErrInvalidDPoPProof)
+	}
+	if !sameDPoPURI(claims.URI, uri) {
+		return DPoPProof{}, fmt.Errorf("%w: htu does not match", ErrInvalidDPoPProof)
+	}
+
+	issuedAt := claims.IssuedAt.Time
+	if issuedAt.Before(now.Add(-DPoPProofMaxAge)) || issuedAt.After(now.Add(dpopClockSkew)) {
+		return DPoPProof{}, fmt.Errorf("%w: iat out of range", ErrInvalidDPoPProof)
+	}
+
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		ath := base64.RawURLEncoding.EncodeToString(sum[:])
+		if subtle.ConstantTimeCompare([]byte(claims.AccessToken), []byte(ath)) != 1 {
+			return DPoPProof{}, fmt.Errorf("%w: ath does not match", ErrInvalidDPoPProof)
+		}
+	}
+
+	return DPoPProof{ID: claims.ID, Thumbprint: thumbprint, IssuedAt: issuedAt}, nil
+}
+
+// sameDPoPURI compares the htu claim to the request URI, ignoring query,
+// fragment and the case of scheme and host (RFC 9449 section 4.3).
+func sameDPoPURI(htu, uri string) bool {
+	normalize := func(s string) (string, bool) {
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return "", false
+		}
+		return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host) + u.EscapedPath(), true
+	}
+
+	a, ok := normalize(htu)
+	if !ok {
+		return false
+	}
+	b, ok := normalize(uri)
+	return ok && a == b
+}
+
+// parseDPoPKey returns the public key of a proof along with its thumbprint.
+func parseDPoPKey(jwk map[string]any) (crypto.PublicKey, string, error) {
+	member := func(name string) string {
+		s, _ := jwk[name].(string)
+		return s
+	}
+	decode := func(name string) []byte {
+		b, _ := base64.RawURLEncoding.DecodeString(member(name))
+		return b
+	}
+
+	// A proof must never carry the private key.
+	if _, ok := jwk["d"]; ok {
+		return nil, "", errors.New("jwk contains a private key")
+	}
+
+	var key crypto.PublicKey
+	var required []string
+	switch member("kty") {
+	case "EC":
+		var curve elliptic.Curve
+		switch member("crv") {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, "", errors.New("unsupported curve")
+		}
+		x, y := new(big.Int).SetBytes(decode("x")), new(big.Int).SetBytes(decode("y"))
+		if !curve.IsOnCurve(x, y) {
+			return nil, "", errors.New("invalid ec key")
+		}
+		key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		required = []string{"crv", "kty", "x", "y"}
+	case "RSA":
+		n, e := decode("n"), decode("e")
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, "", errors.New("invalid rsa key")
+		}
+		key = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		required = []string{"e", "kty", "n"}
+	case "OKP":
+		x := decode("x")
+		if member("crv") != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, "", errors.New("unsupported okp key")
+		}
+		key = ed25519.PublicKey(x)
+		required = []string{"crv", "kty", "x"}
+	default:
+		return nil, "", errors.New("unsupported key type")
+	}
+
+	return key, jwkThumbprint(jwk, required), nil
+}
+
+// jwkThumbprint returns the RFC 7638 thumbprint over the required members
+// of jwk, which must be given in lexicographic order.
+func jwkThumbprint(jwk map[string]any, required []string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range required {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(name)
+		value, _ := json.Marshal(jwk[name])
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+
+	sum := sha256.Sum256([]byte(b.String()))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// GetDPoPToken returns the token of a DPoP Authorization header.
+func GetDPoPToken(headers http.Header) (string, error) {
+	scheme, token, ok := strings.Cut(headers.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "dpop") || token == "" || strings.Contains(token, " ") {
+		return "", errors.New("invalid authorization header")
+	}
+	return token, nil
+}
+
+// ReplayCache remembers keys until they expire, such as the IDs of DPoP
+// proofs, so that each one is only accepted once by this server.
+type ReplayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+func NewReplayCache() *ReplayCache {
+	return &ReplayCache{seen: map[string]time.Time{}}
+}
+
+// Add records key until expiresAt. It reports false if key was recorded
+// already and has not expired.
+func (c *ReplayCache) Add(key string, expiresAt, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if seenUntil, ok := c.seen[key]; ok && now.Before(seenUntil) {
+		return false
+	}
+	c.seen[key] = expiresAt
+	return true
+}
+
+// Prune forgets the keys that expired before now.
+func (c *ReplayCache) Prune(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, expiresAt := range c.seen {
+		if !now.Before(expiresAt) {
+			delete(c.seen, key)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func makeDPoPProof(t *testing.T, key *ecdsa.PrivateKey, header map[string]any, claims jwt.MapClaims) string {
+	t.Helper()
+
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = map[string]any{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(x),
+		"y":   base64.RawURLEncoding.EncodeToString(y),
+	}
+	for k, v := range header {
+		token.Header[k] = v
+	}
+
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return proof
+}
+
+func TestJWKThumbprint(t *testing.T) {
+	// The example of RFC 7638 section 3.1.
+	jwk := map[string]any{
+		"kty": "RSA",
+		"n":   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		"e":   "AQAB",
+		"alg": "RS256",
+		"kid": "2011-04-29",
+	}
+
+	_, thumbprint, err := parseDPoPKey(jwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; thumbprint != want {
+		t.Fatalf("thumbprint = %s, want %s", thumbprint, want)
+	}
+}
+
+func TestVerifyDPoPProof(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	accessToken := "access-token"
+	sum := sha256.Sum256([]byte(accessToken))
+	ath := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	claims := func(overrides jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"jti": uuid.NewString(),
+			"htm": "GET",
+			"htu": "https://chirpy.example/api/chirps",
+			"iat": now.Unix(),
+			"ath": ath,
+		}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return c
+	}
+
+	proof := makeDPoPProof(t, key, nil, claims(jwt.MapClaims{"htu": "HTTPS://Chirpy.example/api/chirps?author_id=1"}))
+	verified, err := VerifyDPoPProof(proof, "GET", "https://chirpy.example/api/chirps", accessToken, now)
+	if err != nil {
+		t.Fatalf("VerifyDPoPProof: %v", err)
+	}
+	other := makeDPoPProof(t, otherKey, nil, claims(nil))
+	otherVerified, err := VerifyDPoPProof(other, "GET", "https://chirpy.example/api/chirps", accessToken, now)
+	if err != nil {
+		t.Fatalf("VerifyDPoPProof: %v", err)
+	}
+	if verified.Thumbprint == "" || verified.Thumbprint == otherVerified.Thumbprint {
+		t.Fatalf("thumbprints %q and %q do not identify the keys", verified.Thumbprint, otherVerified.Thumbprint)
+	}
+
+	tests := []struct {
+		name   string
+		header map[string]any
+		claims jwt.MapClaims
+	}{
+		{"wrong method", nil, claims(jwt.MapClaims{"htm": "POST"})},
+		{"wrong uri", nil, claims(jwt.MapClaims{"htu": "https://evil.example/api/chirps"})},
+		{"stale", nil, claims(jwt.MapClaims{"iat": now.Add(-10 * time.Minute).Unix()})},
+		{"future", nil, claims(jwt.MapClaims{"iat": now.Add(10 * time.Minute).Unix()})},
+		{"other access token", nil, claims(jwt.MapClaims{"ath": "nope"})},
+		{"missing jti", nil, claims(jwt.MapClaims{"jti": ""})},
+		{"wrong typ", map[string]any{"typ": "JWT"}, claims(nil)},
+		{"private key", map[string]any{"jwk": map[string]any{"kty": "EC", "crv": "P-256", "d": "secret"}}, claims(nil)},
+	}
+
+	for _, tt := range tests {
+		proof := makeDPoPProof(t, key, tt.header, tt.claims)
+		_, err := VerifyDPoPProof(proof, "GET", "https://chirpy.example/api/chirps", accessToken, now)
+		if !errors.Is(err, ErrInvalidDPoPProof) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, ErrInvalidDPoPProof)
+		}
+	}
+}
+
+func TestBoundJWT(t *testing.T) {
+	keys, err := NewKeyring(NewHMACKey("test", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := MakeBoundJWT(uuid.New(), uuid.New(), RoleUser, "thumbprint", keys, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseJWT(token, keys, AccessTokenOptions(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := claims.DPoPThumbprint(); got != "thumbprint" {
+		t.Fatalf("DPoPThumbprint = %q, want %q", got, "thumbprint")
+	}
+
+	token, err = MakeJWT(uuid.New(), uuid.New(), RoleUser, keys, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err = ParseJWT(token, keys, AccessTokenOptions(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := claims.DPoPThumbprint(); got != "" {
+		t.Fatalf("DPoPThumbprint of a bearer token = %q", got)
+	}
+}
+
+func TestGetDPoPToken(t *testing.T) {
+	headers := http.Header{}
+	headers.Set("Authorization", "DPoP abc.def.ghi")
+	token, err := GetDPoPToken(headers)
+	if err != nil || token != "abc.def.ghi" {
+		t.Fatalf("GetDPoPToken = %q, %v", token, err)
+	}
+
+	headers.Set("Authorization", "Bearer abc.def.ghi")
+	if _, err := GetDPoPToken(headers); err == nil {
+		t.Fatal("GetDPoPToken accepted a bearer token")
+	}
+}
+
+func TestReplayCache(t *testing.T) {
+	cache := NewReplayCache()
+	now := time.Now()
+
+	if !cache.Add("a", now.Add(time.Minute), now) {
+		t.Fatal("first Add reported a replay")
+	}
+	if cache.Add("a", now.Add(time.Minute), now.Add(30*time.Second)) {
+		t.Fatal("second Add was not reported as a replay")
+	}
+
+	cache.Prune(now.Add(2 * time.Minute))
+	if !cache.Add("a", now.Add(3*time.Minute), now.Add(2*time.Minute)) {
+		t.Fatal("Add after expiry reported a replay")
+	}
+}
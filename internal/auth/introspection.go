@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+// MinServiceKeyLength is the shortest API key an internal service may use.
+const MinServiceKeyLength = 32
+
+// ServiceKeys maps the names of the internal services allowed to introspect
+// tokens to their API keys.
+type ServiceKeys map[string]string
+
+// ParseServiceKeys parses a comma separated list of name=key entries.
+func ParseServiceKeys(list string) (ServiceKeys, error) {
+	keys := ServiceKeys{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, key, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || len(key) < MinServiceKeyLength {
+			return nil, fmt.Errorf("invalid entry for %q, keys need at least %d characters", name, MinServiceKeyLength)
+		}
+		if _, ok := keys[name]; ok {
+			return nil, fmt.Errorf("duplicate entry for %q", name)
+		}
+		keys[name] = key
+	}
+	return keys, nil
+}
+
+// Lookup returns the name of the service apiKey belongs to. Every key is
+// compared in constant time, so the timing doesn't tell which one matched.
+func (k ServiceKeys) Lookup(apiKey string) (string, bool) {
+	service := ""
+	for name, key := range k {
+		if subtle.ConstantTimeCompare([]byte(apiKey), []byte(key)) == 1 {
+			service = name
+		}
+	}
+	return service, service != ""
+}
+
+// TokenKind is one of the kinds of tokens Chirpy issues.
+type TokenKind int
+
+const (
+	KindRefreshToken TokenKind = iota
+	KindAccessToken
+	KindPersonalAccessToken
+)
+
+// KindOfToken tells the kind of token by its shape: personal access tokens
+// carry their prefix and access tokens are JWTs. Anything else can only be
+// a refresh token.
+func KindOfToken(token string) TokenKind {
+	switch {
+	case IsPersonalAccessToken(token):
+		return KindPersonalAccessToken
+	case strings.Count(token, ".") == 2:
+		return KindAccessToken
+	default:
+		return KindRefreshToken
+	}
+}
@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestParseServiceKeys(t *testing.T) {
+	key := strings.Repeat("k", MinServiceKeyLength)
+	other := strings.Repeat("o", MinServiceKeyLength+8)
+
+	tests := []struct {
+		name    string
+		list    string
+		want    ServiceKeys
+		wantErr bool
+	}{
+		{"empty", "", ServiceKeys{}, false},
+		{"one", "search=" + key, ServiceKeys{"search": key}, false},
+		{"several with spaces", " search=" + key + " , billing=" + other + ",", ServiceKeys{"search": key, "billing": other}, false},
+		{"key may contain equals", "search=" + key + "==", ServiceKeys{"search": key + "=="}, false},
+		{"short key", "search=" + key[1:], nil, true},
+		{"missing name", "=" + key, nil, true},
+		{"missing key", "search", nil, true},
+		{"duplicate name", "search=" + key + ",search=" + other, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseServiceKeys(tt.list)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseServiceKeys() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseServiceKeys() = %v, want %v", got, tt.want)
+			}
+			for name, key := range tt.want {
+				if got[name] != key {
+					t.Errorf("ParseServiceKeys()[%q] = %q, want %q", name, got[name], key)
+				}
+			}
+		})
+	}
+}
+
+func TestServiceKeysLookup(t *testing.T) {
+	keys := ServiceKeys{
+		"search":  strings.Repeat("s", MinServiceKeyLength),
+		"billing": strings.Repeat("b", MinServiceKeyLength),
+	}
+
+	tests := []struct {
+		apiKey string
+		want   string
+		ok     bool
+	}{
+		{keys["search"], "search", true},
+		{keys["billing"], "billing", true},
+		{keys["search"][1:], "", false},
+		{keys["search"] + "s", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := keys.Lookup(tt.apiKey)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Lookup(%q) = %q, %v, want %q, %v", tt.apiKey, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestKindOfToken(t *testing.T) {
+	keys, err := NewKeyring(NewHMACKey("test", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwt, err := MakeJWT(uuid.New(), uuid.New(), RoleUser, keys, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pat, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	refresh, err := MakeRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  TokenKind
+	}{
+		{"access token", jwt, KindAccessToken},
+		{"personal access token", pat, KindPersonalAccessToken},
+		{"refresh token", refresh, KindRefreshToken},
+		{"garbage", "not.a-token", KindRefreshToken},
+	}
+
+	for _, tt := range tests {
+		if got := KindOfToken(tt.token); got != tt.want {
+			t.Errorf("%s: KindOfToken() = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a single JWT key identified by its kid. Keys loaded from a public
+// key can only verify tokens; keys with a private part can also sign them.
+type Key struct {
+	ID     string
+	Method jwt.SigningMethod
+
+	signKey   any
+	verifyKey any
+}
+
+// NewHMACKey returns a symmetric HS256 key. HMAC keys are never published
+// in the JWKS.
+func NewHMACKey(id string, secret []byte) *Key {
+	return &Key{ID: id, Method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret}
+}
+
+// ParseKeyPEM parses an RSA or Ed25519 key in PEM form. Private keys are
+// used as RS256/EdDSA signing keys, public keys as verification-only keys.
+func ParseKeyPEM(id string, data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, signKey: k, verifyKey: k.Public()}, nil
+	case *rsa.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodRS256, verifyKey: k}, nil
+	case ed25519.PrivateKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, signKey: k, verifyKey: k.Public()}, nil
+	case ed25519.PublicKey:
+		return &Key{ID: id, Method: jwt.SigningMethodEdDSA, verifyKey: k}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+}
+
+// LoadKeyFile reads a PEM key from path, see ParseKeyPEM.
+func LoadKeyFile(id, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKeyPEM(id, data)
+}
+
+// CanSign reports whether the key holds private key material.
+func (k *Key) CanSign() bool {
+	return k.signKey != nil
+}
+
+// Keyring holds the key new tokens are signed with and every key that
+// tokens are still accepted from. During a rotation the old key stays in
+// the ring as a verification key until its tokens have expired.
+type Keyring struct {
+	signing *Key
+	keys    map[string]*Key
+}
+
+// NewKeyring builds a keyring that signs with signing and verifies with
+// signing plus any of the additional keys.
+func NewKeyring(signing *Key, verify ...*Key) (*Keyring, error) {
+	if signing == nil || !signing.CanSign() {
+		return nil, errors.New("signing key must include a private key")
+	}
+
+	keys := map[string]*Key{signing.ID: signing}
+	for _, key := range verify {
+		if _, ok := keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		keys[key.ID] = key
+	}
+
+	return &Keyring{signing: signing, keys: keys}, nil
+}
+
+// SigningKey returns the key new tokens are signed with.
+func (k *Keyring) SigningKey() *Key {
+	return k.signing
+}
+
+// Lookup returns the verification key with the given kid.
+func (k *Keyring) Lookup(kid string) (*Key, bool) {
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// Algorithms returns the distinct signing algorithms of the keys in the ring.
+func (k *Keyring) Algorithms() []string {
+	seen := map[string]bool{}
+	var algs []string
+	for _, key := range k.keys {
+		alg := key.Method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+// JWK is a JSON Web Key as defined in RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served from the JWKS endpoint.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS returns the public part of every asymmetric key in the ring.
+func (k *Keyring) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range k.keys {
+		jwk, ok := publicJWK(key.verifyKey)
+		if !ok {
+			continue
+		}
+		jwk.Kid = key.ID
+		jwk.Use = "sig"
+		jwk.Alg = key.Method.Alg()
+		set.Keys = append(set.Keys, jwk)
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+func publicJWK(key any) (JWK, bool) {
+	enc := base64.RawURLEncoding
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return JWK{Kty: "RSA", N: enc.EncodeToString(k.N.Bytes()), E: enc.EncodeToString(big.NewInt(int64(k.E)).Bytes())}, true
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: enc.EncodeToString(k)}, true
+	default:
+		return JWK{}, false
+	}
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func rsaKeyPEM(t *testing.T) (private, public []byte) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	private = pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	public = pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	return private, public
+}
+
+func ed25519KeyPEM(t *testing.T) []byte {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestParseKeyPEM(t *testing.T) {
+	rsaPrivate, rsaPublic := rsaKeyPEM(t)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		alg     string
+		canSign bool
+	}{
+		{"rsa private", rsaPrivate, "RS256", true},
+		{"rsa public", rsaPublic, "RS256", false},
+		{"ed25519 private", ed25519KeyPEM(t), "EdDSA", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseKeyPEM("kid", tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.Method.Alg() != tt.alg {
+				t.Fatalf("alg = %s, want %s", key.Method.Alg(), tt.alg)
+			}
+			if key.CanSign() != tt.canSign {
+				t.Fatalf("CanSign = %v, want %v", key.CanSign(), tt.canSign)
+			}
+		})
+	}
+
+	if _, err := ParseKeyPEM("kid", []byte("not a key")); err == nil {
+		t.Fatal("expected error for invalid PEM")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	userID := uuid.New()
+	rsaPrivate, rsaPublic := rsaKeyPEM(t)
+
+	oldKey, err := ParseKeyPEM("old", rsaPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := ParseKeyPEM("new", ed25519KeyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldPublic, err := ParseKeyPEM("old", rsaPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := NewKeyring(oldKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := MakeJWT(userID, uuid.New(), RoleUser, before, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	during, err := NewKeyring(newKey, oldPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := MakeJWT(userID, uuid.New(), RoleUser, during, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := ValidateJWT(token, during, AccessTokenOptions(during)); err != nil {
+			t.Fatalf("token rejected during rotation: %v", err)
+		}
+	}
+
+	after, err := NewKeyring(newKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateJWT(oldToken, after, AccessTokenOptions(after)); err == nil {
+		t.Fatal("token signed with retired key was accepted")
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaPrivate, _ := rsaKeyPEM(t)
+	rsaKey, err := ParseKeyPEM("b-rsa", rsaPrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edKey, err := ParseKeyPEM("a-ed", ed25519KeyPEM(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewKeyring(rsaKey, edKey, NewHMACKey("hmac", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := keys.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("got %d keys, want 2 (HMAC keys must not be published)", len(set.Keys))
+	}
+	if set.Keys[0].Kid != "a-ed" || set.Keys[0].Kty != "OKP" || set.Keys[0].X == "" {
+		t.Fatalf("unexpected Ed25519 JWK: %+v", set.Keys[0])
+	}
+	if set.Keys[1].Kid != "b-rsa" || set.Keys[1].Kty != "RSA" || set.Keys[1].E != "AQAB" {
+		t.Fatalf("unexpected RSA JWK: %+v", set.Keys[1])
+	}
+}
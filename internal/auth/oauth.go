@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+)
+
+// ParseScope splits an OAuth scope parameter into its scopes.
+func ParseScope(scope string) []string {
+	return strings.Fields(scope)
+}
+
+// ValidCodeVerifier reports whether verifier is a well formed PKCE code
+// verifier as defined in RFC 7636 section 4.1.
+func ValidCodeVerifier(verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	for _, c := range verifier {
+		switch {
+		case c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z', c >= '0' && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// PKCEChallenge returns the S256 code challenge for verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyPKCE reports whether verifier matches the S256 code challenge sent
+// with the authorization request.
+func VerifyPKCE(verifier, challenge string) bool {
+	if !ValidCodeVerifier(verifier) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(PKCEChallenge(verifier)), []byte(challenge)) == 1
+}
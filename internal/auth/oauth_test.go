@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The example from RFC 7636 appendix B.
+func TestVerifyPKCE(t *testing.T) {
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if got := PKCEChallenge(verifier); got != challenge {
+		t.Fatalf("PKCEChallenge = %s, want %s", got, challenge)
+	}
+
+	tests := []struct {
+		name     string
+		verifier string
+		ok       bool
+	}{
+		{"matching", verifier, true},
+		{"other verifier", strings.Repeat("a", 43), false},
+		{"too short", "abc", false},
+		{"invalid characters", strings.Repeat("a", 42) + "+", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok := VerifyPKCE(tt.verifier, challenge); ok != tt.ok {
+				t.Fatalf("VerifyPKCE = %v, want %v", ok, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDelegatedJWT(t *testing.T) {
+	userID, clientID, sessionID := uuid.New(), uuid.New(), uuid.New()
+	keys, err := NewKeyring(NewHMACKey("test", []byte("secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := MakeDelegatedJWT(userID, clientID, sessionID, []string{ScopeChirpsRead, ScopeChirpsWrite}, keys, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ParseJWT(token, keys, AccessTokenOptions(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID() != userID || claims.ClientID != clientID.String() || claims.SessionID != sessionID.String() || !claims.Delegated() || claims.Role != "" {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+	if !slices.Equal(claims.Scopes(), []string{ScopeChirpsRead, ScopeChirpsWrite}) {
+		t.Fatalf("got scopes %v", claims.Scopes())
+	}
+
+	session, err := MakeJWT(userID, uuid.New(), RoleModerator, keys, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err = ParseJWT(session, keys, AccessTokenOptions(keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Delegated() || claims.Role != RoleModerator {
+		t.Fatalf("unexpected login session claims %+v", claims)
+	}
+}
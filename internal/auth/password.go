@@ -0,0 +1,129 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch = errors.New("password does not match")
+	ErrUnknownHash      = errors.New("unknown password hash format")
+)
+
+// Argon2Params are the argon2id cost parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// DefaultArgon2Params follow the OWASP recommendation for argon2id.
+var DefaultArgon2Params = Argon2Params{
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+// PasswordHasher hashes new passwords as PHC strings
+// ($argon2id$v=19$m=...,t=...,p=...$salt$hash) and still verifies the
+// bcrypt hashes created before argon2id was introduced.
+type PasswordHasher struct {
+	Params Argon2Params
+}
+
+func HashPassword(password string) (string, error) {
+	return PasswordHasher{DefaultArgon2Params}.Hash(password)
+}
+
+func CheckPasswordHash(password, hash string) error {
+	_, err := PasswordHasher{DefaultArgon2Params}.Verify(password, hash)
+	return err
+}
+
+func (h PasswordHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+
+	enc := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Params.Memory, h.Params.Iterations, h.Params.Parallelism,
+		enc.EncodeToString(salt), enc.EncodeToString(key)), nil
+}
+
+// Verify checks password against hash. On success it also reports whether
+// the hash was made with another algorithm or with parameters other than
+// the ones h uses, in which case the caller should store a fresh hash. Any
+// change of parameters counts, so lowering them also rehashes on login.
+func (h PasswordHasher) Verify(password, hash string) (needsRehash bool, err error) {
+	if strings.HasPrefix(hash, "$2") {
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrPasswordMismatch
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	params, salt, key, err := decodeArgon2Hash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, params.KeyLength)
+	if subtle.ConstantTimeCompare(key, candidate) != 1 {
+		return false, ErrPasswordMismatch
+	}
+
+	return params != h.Params, nil
+}
+
+func decodeArgon2Hash(hash string) (Argon2Params, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[0] != "" || parts[1] != "argon2id" {
+		return Argon2Params{}, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2Params{}, nil, nil, fmt.Errorf("%w: unsupported argon2 version", ErrUnknownHash)
+	}
+
+	var params Argon2Params
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism)
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+
+	enc := base64.RawStdEncoding
+	salt, err := enc.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+	key, err := enc.DecodeString(parts[5])
+	if err != nil {
+		return Argon2Params{}, nil, nil, fmt.Errorf("%w: %v", ErrUnknownHash, err)
+	}
+
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2Params = Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHasherPHCFormat(t *testing.T) {
+	hash, err := PasswordHasher{testArgon2Params}.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Fatalf("unexpected hash format %s", hash)
+	}
+}
+
+func TestPasswordHasherVerify(t *testing.T) {
+	hasher := PasswordHasher{testArgon2Params}
+
+	current, err := hasher.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weaker := testArgon2Params
+	weaker.Memory = 512
+	outdated, err := PasswordHasher{weaker}.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stronger := testArgon2Params
+	stronger.Iterations++
+	newer, err := PasswordHasher{stronger}.Hash("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		password    string
+		hash        string
+		needsRehash bool
+		wantErr     error
+	}{
+		{"current argon2id", "password", current, false, nil},
+		{"outdated parameters", "password", outdated, true, nil},
+		{"stronger parameters", "password", newer, true, nil},
+		{"legacy bcrypt", "password", string(legacy), true, nil},
+		{"wrong password argon2id", "wrong", current, false, ErrPasswordMismatch},
+		{"wrong password bcrypt", "wrong", string(legacy), false, ErrPasswordMismatch},
+		{"unknown format", "password", "plaintext", false, ErrUnknownHash},
+		{"malformed parameters", "password", "$argon2id$v=19$m=x$c2FsdA$a2V5", false, ErrUnknownHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			needsRehash, err := hasher.Verify(tt.password, tt.hash)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if needsRehash != tt.needsRehash {
+				t.Fatalf("needsRehash = %v, want %v", needsRehash, tt.needsRehash)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package auth
+
+import "slices"
+
+// Roles grant privileges beyond a user's own data. Each role includes the
+// privileges of the roles before it.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// Roles lists every role from least to most privileged.
+var Roles = []string{RoleUser, RoleModerator, RoleAdmin}
+
+// ValidRole reports whether role is a known role.
+func ValidRole(role string) bool {
+	return slices.Contains(Roles, role)
+}
+
+// HasRole reports whether role includes the privileges of required. Unknown
+// roles have no privileges.
+func HasRole(role, required string) bool {
+	have := slices.Index(Roles, role)
+	want := slices.Index(Roles, required)
+	return have >= 0 && want >= 0 && have >= want
+}
@@ -0,0 +1,27 @@
+package auth
+
+import "testing"
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		want     bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{RoleModerator, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{RoleAdmin, RoleAdmin, true},
+		{"", RoleUser, false},
+		{"root", RoleUser, false},
+		{RoleAdmin, "root", false},
+	}
+
+	for _, tt := range tests {
+		if got := HasRole(tt.role, tt.required); got != tt.want {
+			t.Errorf("HasRole(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"slices"
+	"strings"
+)
+
+// Scopes limit what a delegated token, such as a personal access token, may
+// do on behalf of its user. A regular login session is not limited.
+const (
+	ScopeChirpsRead   = "chirps:read"
+	ScopeChirpsWrite  = "chirps:write"
+	ScopeProfileWrite = "profile:write"
+)
+
+// Scopes lists every scope a token can be granted.
+var Scopes = []string{ScopeChirpsRead, ScopeChirpsWrite, ScopeProfileWrite}
+
+// ValidScopes reports whether every entry of scopes is a known scope.
+func ValidScopes(scopes []string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
+
+// personalAccessTokenPrefix marks personal access tokens so they can be
+// told apart from JWTs and spotted by secret scanners.
+const personalAccessTokenPrefix = "chirpy_pat_"
+
+// MakePersonalAccessToken returns a new random personal access token.
+func MakePersonalAccessToken() (string, error) {
+	token, err := MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	return personalAccessTokenPrefix + token, nil
+}
+
+// IsPersonalAccessToken reports whether a bearer token is a personal access
+// token rather than a JWT.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, personalAccessTokenPrefix)
+}
@@ -0,0 +1,28 @@
+package auth
+
+import "testing"
+
+func TestValidScopes(t *testing.T) {
+	if !ValidScopes([]string{ScopeChirpsRead, ScopeProfileWrite}) {
+		t.Fatal("known scopes rejected")
+	}
+	if !ValidScopes(nil) {
+		t.Fatal("empty scope list rejected")
+	}
+	if ValidScopes([]string{ScopeChirpsWrite, "admin"}) {
+		t.Fatal("unknown scope accepted")
+	}
+}
+
+func TestMakePersonalAccessToken(t *testing.T) {
+	token, err := MakePersonalAccessToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsPersonalAccessToken(token) {
+		t.Fatalf("token %q not recognised as personal access token", token)
+	}
+	if IsPersonalAccessToken("eyJhbGciOiJIUzI1NiJ9.e30.sig") {
+		t.Fatal("JWT recognised as personal access token")
+	}
+}
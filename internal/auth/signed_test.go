@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSignedToken(t *testing.T) {
+	token := MakeSignedToken("secret", "verify-email", "user:alice@example.com", time.Minute)
+
+	data, err := VerifySignedToken("secret", "verify-email", token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != "user:alice@example.com" {
+		t.Fatalf("data = %q", data)
+	}
+
+	tests := []struct {
+		name    string
+		secret  string
+		purpose string
+		token   string
+		wantErr error
+	}{
+		{"wrong secret", "other", "verify-email", token, ErrSignedTokenInvalid},
+		{"wrong purpose", "secret", "reset-password", token, ErrSignedTokenInvalid},
+		{"tampered", "secret", "verify-email", "x" + token, ErrSignedTokenInvalid},
+		{"malformed", "secret", "verify-email", "abc", ErrSignedTokenInvalid},
+		{"expired", "secret", "verify-email", MakeSignedToken("secret", "verify-email", "data", -time.Second), ErrSignedTokenExpired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := VerifySignedToken(tt.secret, tt.purpose, tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -11,6 +11,17 @@ import (
 	"github.com/google/uuid"
 )
 
+const countChirpsByUserID = `-- name: CountChirpsByUserID :one
+SELECT COUNT(*) FROM chirps WHERE user_id = $1
+`
+
+func (q *Queries) CountChirpsByUserID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByUserID, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps (id, created_at, updated_at, body, user_id)
 VALUES (
@@ -19,20 +19,181 @@ type Chirp struct {
 	UserID    uuid.UUID
 }
 
+type DataExport struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	UserID      uuid.UUID
+	Status      string
+	Archive     []byte
+	CompletedAt sql.NullTime
+	ExpiresAt   sql.NullTime
+}
+
+type EmailChange struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	OldEmail    string
+	NewEmail    string
+	ConfirmedAt sql.NullTime
+	RevertedAt  sql.NullTime
+}
+
+type LoginAttempt struct {
+	ThrottleKey  string
+	Failures     int32
+	LastFailedAt time.Time
+	BlockedUntil time.Time
+}
+
+type MagicLink struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UserID     uuid.UUID
+	NonceHash  string
+	UseCookies bool
+	ExpiresAt  time.Time
+	UsedAt     sql.NullTime
+}
+
+type OauthAuthorizationCode struct {
+	CodeHash      string
+	CreatedAt     time.Time
+	ClientID      uuid.UUID
+	UserID        uuid.UUID
+	RedirectUri   string
+	Scopes        []string
+	CodeChallenge string
+	FamilyID      uuid.UUID
+	ExpiresAt     time.Time
+	UsedAt        sql.NullTime
+}
+
+type OauthClient struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uuid.UUID
+	Name         string
+	SecretHash   sql.NullString
+	RedirectUris []string
+	Scopes       []string
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PersonalAccessToken struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Name       string
+	TokenHash  string
+	Scopes     []string
+	ExpiresAt  sql.NullTime
+	LastUsedAt sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	CodeHash  string
+	UsedAt    sql.NullTime
+}
+
 type RefreshToken struct {
-	Token     string
+	TokenHash  string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	FamilyID   uuid.UUID
+	ReplacedBy sql.NullString
+	ClientID   uuid.NullUUID
+	Scopes     []string
+	UserAgent  string
+	IpAddress  string
+	LastUsedAt time.Time
+	DpopJkt    string
+}
+
+type ReleasedHandle struct {
+	UserID     uuid.UUID
+	Handle     string
+	ReleasedAt time.Time
+}
+
+type RevokedAccessToken struct {
+	Jti       string
 	CreatedAt time.Time
-	UpdatedAt time.Time
 	UserID    uuid.UUID
 	ExpiresAt time.Time
-	RevokedAt sql.NullTime
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                  uuid.UUID
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	Email               string
+	HashedPassword      string
+	IsChirpyRed         bool
+	EmailVerifiedAt     sql.NullTime
+	VerificationSentAt  sql.NullTime
+	Role                string
+	Handle              sql.NullString
+	DisplayName         string
+	Bio                 string
+	Location            string
+	Website             string
+	DeletionRequestedAt sql.NullTime
+	LegacyUnverified    bool
+}
+
+type UserIdentity struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	Provider  string
+	Subject   string
+	Email     string
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Secret       string
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
+}
+
+type WebauthnChallenge struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.NullUUID
+	Ceremony  string
+	Challenge []byte
+	ExpiresAt time.Time
+}
+
+type WebauthnCredential struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	UserID       uuid.UUID
+	CredentialID []byte
+	PublicKey    []byte
+	SignCount    int64
+	Name         string
+	LastUsedAt   sql.NullTime
 }
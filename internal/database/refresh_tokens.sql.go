@@ -7,74 +7,389 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createRefreshToken = `-- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, family_id, client_id, scopes, user_agent, ip_address, last_used_at, dpop_jkt)
 VALUES ($1,
         NOW(),
         NOW(),
         $2,
-        $3)
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+        $3,
+        $4,
+        $5,
+        $6,
+        $7,
+        $8,
+        NOW(),
+        $9)
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, client_id, scopes, user_agent, ip_address, last_used_at, dpop_jkt
 `
 
 type CreateRefreshTokenParams struct {
-	Token     string
+	TokenHash string
 	UserID    uuid.UUID
 	ExpiresAt time.Time
+	FamilyID  uuid.UUID
+	ClientID  uuid.NullUUID
+	Scopes    []string
+	UserAgent string
+	IpAddress string
+	DpopJkt   string
 }
 
 func (q *Queries) CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, createRefreshToken, arg.Token, arg.UserID, arg.ExpiresAt)
+	row := q.db.QueryRowContext(ctx, createRefreshToken,
+		arg.TokenHash,
+		arg.UserID,
+		arg.ExpiresAt,
+		arg.FamilyID,
+		arg.ClientID,
+		pq.Array(arg.Scopes),
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.DpopJkt,
+	)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.DpopJkt,
 	)
 	return i, err
 }
 
-const getRefreshTokenByToken = `-- name: GetRefreshTokenByToken :one
-SELECT token, created_at, updated_at, user_id, expires_at, revoked_at FROM refresh_tokens WHERE token = $1 AND revoked_at IS NULL
+const getRefreshTokenByHash = `-- name: GetRefreshTokenByHash :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, client_id, scopes, user_agent, ip_address, last_used_at, dpop_jkt FROM refresh_tokens WHERE token_hash = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) GetRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenByHash, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.DpopJkt,
+	)
+	return i, err
+}
+
+const getRefreshTokenByHashIncludingRevoked = `-- name: GetRefreshTokenByHashIncludingRevoked :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, client_id, scopes, user_agent, ip_address, last_used_at, dpop_jkt FROM refresh_tokens WHERE token_hash = $1
+`
+
+func (q *Queries) GetRefreshTokenByHashIncludingRevoked(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshTokenByHashIncludingRevoked, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.DpopJkt,
+	)
+	return i, err
+}
+
+const getSessionHistoryByUserID = `-- name: GetSessionHistoryByUserID :many
+SELECT DISTINCT ON (t.family_id)
+       t.family_id,
+       t.client_id,
+       t.user_agent,
+       t.ip_address,
+       t.last_used_at,
+       t.expires_at,
+       t.revoked_at,
+       (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = t.family_id)::timestamp AS created_at
+FROM refresh_tokens t
+WHERE t.user_id = $1
+ORDER BY t.family_id, t.created_at DESC
+`
+
+type GetSessionHistoryByUserIDRow struct {
+	FamilyID   uuid.UUID
+	ClientID   uuid.NullUUID
+	UserAgent  string
+	IpAddress  string
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	RevokedAt  sql.NullTime
+	CreatedAt  time.Time
+}
+
+func (q *Queries) GetSessionHistoryByUserID(ctx context.Context, userID uuid.UUID) ([]GetSessionHistoryByUserIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, getSessionHistoryByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetSessionHistoryByUserIDRow
+	for rows.Next() {
+		var i GetSessionHistoryByUserIDRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.ClientID,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.RevokedAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSessionsByUserID = `-- name: GetSessionsByUserID :many
+SELECT t.family_id,
+       t.user_agent,
+       t.ip_address,
+       t.last_used_at,
+       t.expires_at,
+       (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = t.family_id)::timestamp AS created_at
+FROM refresh_tokens t
+WHERE t.user_id = $1 AND t.client_id IS NULL AND t.revoked_at IS NULL AND t.expires_at > NOW()
+ORDER BY t.last_used_at DESC
+`
+
+type GetSessionsByUserIDRow struct {
+	FamilyID   uuid.UUID
+	UserAgent  string
+	IpAddress  string
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+}
+
+func (q *Queries) GetSessionsByUserID(ctx context.Context, userID uuid.UUID) ([]GetSessionsByUserIDRow, error) {
+	rows, err := q.db.QueryContext(ctx, getSessionsByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetSessionsByUserIDRow
+	for rows.Next() {
+		var i GetSessionsByUserIDRow
+		if err := rows.Scan(
+			&i.FamilyID,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeAllSessions = `-- name: RevokeAllSessions :many
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+RETURNING family_id
+`
+
+func (q *Queries) RevokeAllSessions(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, revokeAllSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var family_id uuid.UUID
+		if err := rows.Scan(&family_id); err != nil {
+			return nil, err
+		}
+		items = append(items, family_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeOtherSessions = `-- name: RevokeOtherSessions :many
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND family_id <> $2 AND client_id IS NULL AND revoked_at IS NULL
+RETURNING family_id
+`
+
+type RevokeOtherSessionsParams struct {
+	UserID   uuid.UUID
+	FamilyID uuid.UUID
+}
+
+func (q *Queries) RevokeOtherSessions(ctx context.Context, arg RevokeOtherSessionsParams) ([]uuid.UUID, error) {
+	rows, err := q.db.QueryContext(ctx, revokeOtherSessions, arg.UserID, arg.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var family_id uuid.UUID
+		if err := rows.Scan(&family_id); err != nil {
+			return nil, err
+		}
+		items = append(items, family_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const revokeRefreshTokenByHash = `-- name: RevokeRefreshTokenByHash :one
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE token_hash = $1 AND revoked_at IS NULL
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, client_id, scopes, user_agent, ip_address, last_used_at, dpop_jkt
 `
 
-func (q *Queries) GetRefreshTokenByToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, getRefreshTokenByToken, token)
+func (q *Queries) RevokeRefreshTokenByHash(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, revokeRefreshTokenByHash, tokenHash)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.DpopJkt,
 	)
 	return i, err
 }
 
-const revokeRefreshTokenByToken = `-- name: RevokeRefreshTokenByToken :one
-UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE token = $1 AND revoked_at IS NULL
-RETURNING token, created_at, updated_at, user_id, expires_at, revoked_at
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL
 `
 
-func (q *Queries) RevokeRefreshTokenByToken(ctx context.Context, token string) (RefreshToken, error) {
-	row := q.db.QueryRowContext(ctx, revokeRefreshTokenByToken, token)
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeRefreshTokensByUserID = `-- name: RevokeRefreshTokensByUserID :exec
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokensByUserID(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokensByUserID, userID)
+	return err
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND client_id IS NULL AND revoked_at IS NULL
+`
+
+type RevokeSessionParams struct {
+	FamilyID uuid.UUID
+	UserID   uuid.UUID
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeSession, arg.FamilyID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :one
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW(), replaced_by = $2 WHERE token_hash = $1 AND revoked_at IS NULL
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id, replaced_by, client_id, scopes, user_agent, ip_address, last_used_at, dpop_jkt
+`
+
+type RotateRefreshTokenParams struct {
+	TokenHash  string
+	ReplacedBy sql.NullString
+}
+
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, rotateRefreshToken, arg.TokenHash, arg.ReplacedBy)
 	var i RefreshToken
 	err := row.Scan(
-		&i.Token,
+		&i.TokenHash,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.UserID,
 		&i.ExpiresAt,
 		&i.RevokedAt,
+		&i.FamilyID,
+		&i.ReplacedBy,
+		&i.ClientID,
+		pq.Array(&i.Scopes),
+		&i.UserAgent,
+		&i.IpAddress,
+		&i.LastUsedAt,
+		&i.DpopJkt,
 	)
 	return i, err
 }
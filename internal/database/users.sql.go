@@ -7,29 +7,81 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const cancelUserDeletion = `-- name: CancelUserDeletion :one
+UPDATE users SET updated_at = NOW(), deletion_requested_at = NULL WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, cancelUserDeletion, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
+	)
+	return i, err
+}
+
+const claimVerificationEmail = `-- name: ClaimVerificationEmail :execrows
+UPDATE users SET verification_sent_at = NOW()
+WHERE id = $1 AND email_verified_at IS NULL
+  AND (verification_sent_at IS NULL OR verification_sent_at < $2::timestamp)
+`
+
+type ClaimVerificationEmailParams struct {
+	ID         uuid.UUID
+	SentBefore time.Time
+}
+
+func (q *Queries) ClaimVerificationEmail(ctx context.Context, arg ClaimVerificationEmailParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, claimVerificationEmail, arg.ID, arg.SentBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createUser = `-- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
   gen_random_uuid(),
   NOW(),
   NOW(),
   $1,
-  $2
+  $2,
+  $3
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Handle         sql.NullString
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -38,6 +90,16 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
 	)
 	return i, err
 }
@@ -52,7 +114,7 @@ func (q *Queries) DeleteUsers(ctx context.Context) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -65,13 +127,120 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified FROM users WHERE LOWER(handle) = LOWER($1::text)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
+	)
+	return i, err
+}
+
+const purgeDeletedUsers = `-- name: PurgeDeletedUsers :execrows
+DELETE FROM users WHERE deletion_requested_at < $1::timestamp
+`
+
+func (q *Queries) PurgeDeletedUsers(ctx context.Context, requestedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedUsers, requestedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const requestUserDeletion = `-- name: RequestUserDeletion :one
+UPDATE users SET updated_at = NOW(), deletion_requested_at = NOW() WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified
+`
+
+func (q *Queries) RequestUserDeletion(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, requestUserDeletion, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
 	)
 	return i, err
 }
 
 const updateUser = `-- name: UpdateUser :one
 UPDATE users SET updated_at = NOW(), email = $2, hashed_password = $3 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified
 `
 
 type UpdateUserParams struct {
@@ -90,13 +259,57 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
+	)
+	return i, err
+}
+
+const updateUserEmail = `-- name: UpdateUserEmail :one
+UPDATE users SET updated_at = NOW(), email = $2, email_verified_at = NOW() WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified
+`
+
+type UpdateUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) UpdateUserEmail(ctx context.Context, arg UpdateUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
 	)
 	return i, err
 }
 
 const updateUserIsChirpyRed = `-- name: UpdateUserIsChirpyRed :one
 UPDATE users SET updated_at = NOW(), is_chirpy_red = $2 WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified
 `
 
 type UpdateUserIsChirpyRedParams struct {
@@ -114,6 +327,163 @@ func (q *Queries) UpdateUserIsChirpyRed(ctx context.Context, arg UpdateUserIsChi
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :one
+UPDATE users SET updated_at = NOW(), hashed_password = $2 WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified
+`
+
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
+	)
+	return i, err
+}
+
+const updateUserProfile = `-- name: UpdateUserProfile :one
+UPDATE users SET updated_at = NOW(), handle = $2, display_name = $3, bio = $4, location = $5, website = $6 WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified
+`
+
+type UpdateUserProfileParams struct {
+	ID          uuid.UUID
+	Handle      sql.NullString
+	DisplayName string
+	Bio         string
+	Location    string
+	Website     string
+}
+
+func (q *Queries) UpdateUserProfile(ctx context.Context, arg UpdateUserProfileParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserProfile,
+		arg.ID,
+		arg.Handle,
+		arg.DisplayName,
+		arg.Bio,
+		arg.Location,
+		arg.Website,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
+	)
+	return i, err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users SET updated_at = NOW(), role = $2 WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified
+`
+
+type UpdateUserRoleParams struct {
+	ID   uuid.UUID
+	Role string
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserRole, arg.ID, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
+	)
+	return i, err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users SET updated_at = NOW(), email_verified_at = NOW() WHERE id = $1 AND email = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at, role, handle, display_name, bio, location, website, deletion_requested_at, legacy_unverified
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+		&i.Role,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.DeletionRequestedAt,
+		&i.LegacyUnverified,
 	)
 	return i, err
 }
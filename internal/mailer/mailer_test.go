@@ -0,0 +1,46 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestWriterMailer(t *testing.T) {
+	var buf bytes.Buffer
+	mailer := NewWriterMailer(&buf, "Chirpy <no-reply@chirpy.test>")
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "user@example.com",
+		Subject: "Reset your password",
+		Body:    "line one\nline two",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{
+		"From: Chirpy <no-reply@chirpy.test>\r\n",
+		"To: user@example.com\r\n",
+		"Subject: Reset your password\r\n",
+		"\r\n\r\nline one\r\nline two\r\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("message is missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	mailer := NewWriterMailer(&bytes.Buffer{}, "no-reply@chirpy.test")
+
+	err := mailer.Send(context.Background(), Message{
+		To:      "user@example.com\r\nBcc: victim@example.com",
+		Subject: "Hello",
+	})
+	if err == nil {
+		t.Fatal("expected error for header with line break")
+	}
+}
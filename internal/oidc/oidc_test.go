@@ -0,0 +1,264 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP is a minimal OpenID provider for tests.
+type mockIdP struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu sync.Mutex
+	// codes maps issued authorization codes to their login.
+	codes map[string]mockLogin
+	// claims overrides claims of the next ID token.
+	claims jwt.MapClaims
+}
+
+type mockLogin struct {
+	nonce         string
+	codeChallenge string
+}
+
+const (
+	testClientID     = "chirpy"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "https://chirpy.example/api/sso/corp/callback"
+)
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &mockIdP{t: t, key: key, kid: "key-1", codes: map[string]mockLogin{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", idp.discovery)
+	mux.HandleFunc("GET /jwks", idp.jwks)
+	mux.HandleFunc("POST /token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 idp.server.URL,
+		"authorization_endpoint": idp.server.URL + "/authorize",
+		"token_endpoint":         idp.server.URL + "/token",
+		"jwks_uri":               idp.server.URL + "/jwks",
+	})
+}
+
+func (idp *mockIdP) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": idp.kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize simulates the user logging in at the provider and returns the
+// code the provider would redirect back with.
+func (idp *mockIdP) authorize(authURL string) (code, state string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("client_id") != testClientID || query.Get("redirect_uri") != testRedirectURL {
+		idp.t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	code = rand.Text()
+	idp.codes[code] = mockLogin{query.Get("nonce"), query.Get("code_challenge")}
+	return code, query.Get("state")
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || clientID != testClientID || secret != testClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	idp.mu.Lock()
+	login, ok := idp.codes[r.PostFormValue("code")]
+	delete(idp.codes, r.PostFormValue("code"))
+	extra := idp.claims
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != login.codeChallenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"sub":            "employee-42",
+		"aud":            testClientID,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          login.nonce,
+		"email":          "ada@corp.example",
+		"email_verified": true,
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "opaque", "token_type": "Bearer", "id_token": signed})
+}
+
+func newTestProvider(idp *mockIdP) *Provider {
+	return NewProvider(Config{
+		Name:         "corp",
+		Issuer:       idp.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		Scopes:       []string{"email"},
+	}, idp.server.Client())
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// login runs the authorization code flow against idp and returns the
+// verified ID token.
+func login(t *testing.T, idp *mockIdP, provider *Provider, nonce string) (IDToken, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	verifier := rand.Text() + rand.Text()
+	authURL, err := provider.AuthCodeURL(ctx, "state-1", "nonce-1", codeChallenge(verifier))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := idp.authorize(authURL)
+	if state != "state-1" {
+		t.Fatalf("state = %q, want %q", state, "state-1")
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider.VerifyIDToken(ctx, rawIDToken, nonce)
+}
+
+func TestLogin(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(idp)
+
+	token, err := login(t, idp, provider, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := IDToken{Subject: "employee-42", Email: "ada@corp.example", EmailVerified: true}
+	if token != want {
+		t.Fatalf("token = %+v, want %+v", token, want)
+	}
+}
+
+func TestVerifyIDTokenRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		nonce  string
+		want   error
+	}{
+		{"replayed nonce", nil, "nonce-2", ErrNonceMismatch},
+		{"other issuer", jwt.MapClaims{"iss": "https://evil.example"}, "nonce-1", ErrInvalidIDToken},
+		{"other audience", jwt.MapClaims{"aud": "someone-else"}, "nonce-1", ErrInvalidIDToken},
+		{"expired", jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()}, "nonce-1", ErrInvalidIDToken},
+		{"other authorized party", jwt.MapClaims{"aud": []string{testClientID, "other"}, "azp": "other"}, "nonce-1", ErrInvalidIDToken},
+	}
+
+	for _, tt := range tests {
+		idp := newMockIdP(t)
+		idp.claims = tt.claims
+		_, err := login(t, idp, newTestProvider(idp), tt.nonce)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyIDTokenRejectsForeignKey(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := newTestProvider(idp)
+
+	// A token signed by a key the provider does not publish.
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"sub":   "employee-42",
+		"aud":   testClientID,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": "nonce-1",
+	})
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = provider.VerifyIDToken(context.Background(), signed, "nonce-1")
+	if !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("err = %v, want %v", err, ErrInvalidIDToken)
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := NewProvider(Config{Name: "corp", Issuer: idp.server.URL + "/", ClientID: testClientID}, idp.server.Client())
+
+	_, err := provider.AuthCodeURL(context.Background(), "state", "nonce", "challenge")
+	if err == nil {
+		t.Fatal("discovery accepted a different issuer")
+	}
+}
@@ -0,0 +1,74 @@
+package throttle
+
+import "time"
+
+// Policy decides how long a client has to wait after a number of
+// consecutive failed attempts.
+type Policy struct {
+	// FreeAttempts is how many failures are allowed before any delay.
+	FreeAttempts int
+	// BaseDelay is the delay after the first failure past FreeAttempts.
+	// Every further failure doubles it, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Threshold is the number of failures that locks the key out for
+	// Lockout instead.
+	Threshold int
+	Lockout   time.Duration
+	// ResetAfter is how long after the last failure the count starts over.
+	ResetAfter time.Duration
+}
+
+// DefaultPolicy allows a few typos, then backs off from one second up to
+// five minutes and locks out for fifteen minutes after ten failures.
+var DefaultPolicy = Policy{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxDelay:     5 * time.Minute,
+	Threshold:    10,
+	Lockout:      15 * time.Minute,
+	ResetAfter:   24 * time.Hour,
+}
+
+// Delay returns how long to wait after the given number of failures.
+func (p Policy) Delay(failures int) time.Duration {
+	if p.Threshold > 0 && failures >= p.Threshold {
+		return p.Lockout
+	}
+
+	n := failures - p.FreeAttempts
+	if n <= 0 {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < n; i++ {
+		delay *= 2
+		if delay >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+	return min(delay, p.MaxDelay)
+}
+
+// Locked reports whether the number of failures triggers a lockout.
+func (p Policy) Locked(failures int) bool {
+	return p.Threshold > 0 && failures >= p.Threshold
+}
+
+// Delays lists the delay after 1, 2, ... failures, up to the count from
+// which it stays the same. It lets the database apply the policy when it
+// counts an attempt.
+func (p Policy) Delays() []time.Duration {
+	var delays []time.Duration
+	for failures := 1; ; failures++ {
+		delay := p.Delay(failures)
+		delays = append(delays, delay)
+		if p.Locked(failures) {
+			return delays
+		}
+		if p.Threshold <= 0 && failures > p.FreeAttempts && p.Delay(failures+1) == delay {
+			return delays
+		}
+	}
+}
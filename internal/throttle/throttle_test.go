@@ -0,0 +1,90 @@
+package throttle
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	policy := Policy{
+		FreeAttempts: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     10 * time.Second,
+		Threshold:    8,
+		Lockout:      time.Hour,
+	}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+		locked   bool
+	}{
+		{0, 0, false},
+		{2, 0, false},
+		{3, time.Second, false},
+		{4, 2 * time.Second, false},
+		{5, 4 * time.Second, false},
+		{6, 8 * time.Second, false},
+		{7, 10 * time.Second, false},
+		{8, time.Hour, true},
+		{50, time.Hour, true},
+	}
+
+	for _, tt := range tests {
+		if got := policy.Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+		if got := policy.Locked(tt.failures); got != tt.locked {
+			t.Errorf("Locked(%d) = %v, want %v", tt.failures, got, tt.locked)
+		}
+	}
+}
+
+func TestPolicyWithoutLockout(t *testing.T) {
+	policy := Policy{BaseDelay: time.Second, MaxDelay: time.Minute}
+
+	if got := policy.Delay(1000); got != time.Minute {
+		t.Fatalf("Delay = %s, want %s", got, time.Minute)
+	}
+	if policy.Locked(1000) {
+		t.Fatal("policy without threshold locked out")
+	}
+}
+
+func TestPolicyDelays(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []time.Duration
+	}{
+		{
+			name:   "lockout",
+			policy: Policy{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: 2 * time.Second, Threshold: 5, Lockout: time.Hour},
+			want:   []time.Duration{0, time.Second, 2 * time.Second, 2 * time.Second, time.Hour},
+		},
+		{
+			name:   "without lockout",
+			policy: Policy{FreeAttempts: 1, BaseDelay: time.Second, MaxDelay: 3 * time.Second},
+			want:   []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second},
+		},
+		{
+			name:   "without delays",
+			policy: Policy{FreeAttempts: 2},
+			want:   []time.Duration{0, 0, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		got := tt.policy.Delays()
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: Delays() = %v, want %v", tt.name, got, tt.want)
+		}
+		last := got[len(got)-1]
+		for failures := len(got); failures < len(got)+20; failures++ {
+			if delay := tt.policy.Delay(failures); delay != last {
+				t.Errorf("%s: Delay(%d) = %s after the last listed delay %s", tt.name, failures, delay, last)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errInvalidCBOR = errors.New("invalid cbor")
+
+// maxCBORDepth bounds nesting so hostile input cannot exhaust the stack.
+const maxCBORDepth = 16
+
+// decodeCBOR decodes the first CBOR item in data and returns it along with
+// the bytes that follow it. Only what authenticators emit is supported:
+// definite length integers, strings, arrays, maps and simple values.
+// Integers decode as int64, byte strings as []byte, text as string, arrays
+// as []any and maps as map[any]any.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	return decodeCBORItem(data, 0)
+}
+
+func decodeCBORItem(data []byte, depth int) (any, []byte, error) {
+	if depth > maxCBORDepth || len(data) == 0 {
+		return nil, nil, errInvalidCBOR
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	data = data[1:]
+
+	if major == 7 {
+		switch info {
+		case 20:
+			return false, data, nil
+		case 21:
+			return true, data, nil
+		case 22, 23:
+			return nil, data, nil
+		}
+		return nil, nil, errInvalidCBOR
+	}
+
+	arg, data, err := decodeCBORArgument(info, data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return nil, nil, errInvalidCBOR
+		}
+		return int64(arg), data, nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return nil, nil, errInvalidCBOR
+		}
+		return -1 - int64(arg), data, nil
+	case 2, 3:
+		if arg > uint64(len(data)) {
+			return nil, nil, errInvalidCBOR
+		}
+		if major == 3 {
+			return string(data[:arg]), data[arg:], nil
+		}
+		return append([]byte(nil), data[:arg]...), data[arg:], nil
+	case 4:
+		// Every item takes at least one byte, so this also bounds allocation.
+		if arg > uint64(len(data)) {
+			return nil, nil, errInvalidCBOR
+		}
+		items := make([]any, 0, arg)
+		for range arg {
+			var item any
+			item, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, data, nil
+	case 5:
+		if arg > uint64(len(data))/2 {
+			return nil, nil, errInvalidCBOR
+		}
+		m := make(map[any]any, arg)
+		for range arg {
+			var key, value any
+			key, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, nil, errInvalidCBOR
+			}
+			value, data, err = decodeCBORItem(data, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			if _, ok := m[key]; ok {
+				return nil, nil, errInvalidCBOR
+			}
+			m[key] = value
+		}
+		return m, data, nil
+	}
+	return nil, nil, errInvalidCBOR
+}
+
+func decodeCBORArgument(info byte, data []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), data, nil
+	case info == 24 && len(data) >= 1:
+		return uint64(data[0]), data[1:], nil
+	case info == 25 && len(data) >= 2:
+		return uint64(binary.BigEndian.Uint16(data)), data[2:], nil
+	case info == 26 && len(data) >= 4:
+		return uint64(binary.BigEndian.Uint32(data)), data[4:], nil
+	case info == 27 && len(data) >= 8:
+		return binary.BigEndian.Uint64(data), data[8:], nil
+	}
+	// Indefinite lengths (31) are not allowed in WebAuthn structures.
+	return 0, nil, errInvalidCBOR
+}
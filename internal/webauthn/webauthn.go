@@ -0,0 +1,249 @@
+// Package webauthn verifies the registration and authentication ceremonies
+// of WebAuthn passkeys (https://www.w3.org/TR/webauthn-2/).
+//
+// Attestation statements are not verified. Registrations should ask for
+// "none" attestation, so a credential proves possession of its key but
+// makes no claim about the authenticator model.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/url"
+)
+
+var (
+	ErrInvalidClientData  = errors.New("invalid client data")
+	ErrChallengeMismatch  = errors.New("challenge does not match")
+	ErrOriginMismatch     = errors.New("origin does not match")
+	ErrInvalidAuthData    = errors.New("invalid authenticator data")
+	ErrRPIDMismatch       = errors.New("relying party id does not match")
+	ErrUserNotPresent     = errors.New("user presence is required")
+	ErrUserNotVerified    = errors.New("user verification is required")
+	ErrInvalidSignature   = errors.New("invalid assertion signature")
+	ErrSignCountRegressed = errors.New("sign count did not increase, the authenticator may be cloned")
+)
+
+const (
+	ceremonyCreate = "webauthn.create"
+	ceremonyGet    = "webauthn.get"
+
+	challengeSize = 32
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+	flagExtensions   = 0x80
+)
+
+// RelyingParty is the site credentials are scoped to.
+type RelyingParty struct {
+	// ID is the domain credentials are bound to.
+	ID   string
+	Name string
+	// Origin is the scheme, host and port the browser must report.
+	Origin string
+}
+
+// NewRelyingParty derives the relying party of the site served at baseURL.
+func NewRelyingParty(name, baseURL string) (RelyingParty, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return RelyingParty{}, err
+	}
+	if u.Scheme == "" || u.Hostname() == "" {
+		return RelyingParty{}, errors.New("base url must be absolute")
+	}
+	return RelyingParty{
+		ID:     u.Hostname(),
+		Name:   name,
+		Origin: u.Scheme + "://" + u.Host,
+	}, nil
+}
+
+// NewChallenge returns a random challenge for a ceremony.
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	_, err := rand.Read(challenge)
+	if err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// Credential is a registered public key credential.
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE encoded credential public key.
+	PublicKey []byte
+	SignCount uint32
+}
+
+// VerifyRegistration checks the response to a navigator.credentials.create
+// call made with challenge and returns the new credential.
+func (rp RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte, requireUserVerification bool) (Credential, error) {
+	err := rp.verifyClientData(ceremonyCreate, challenge, clientDataJSON)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	v, rest, err := decodeCBOR(attestationObject)
+	if err != nil || len(rest) != 0 {
+		return Credential{}, ErrInvalidAuthData
+	}
+	attestation, ok := v.(map[any]any)
+	if !ok {
+		return Credential{}, ErrInvalidAuthData
+	}
+	rawAuthData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return Credential{}, ErrInvalidAuthData
+	}
+
+	authData, err := rp.parseAuthData(rawAuthData, requireUserVerification)
+	if err != nil {
+		return Credential{}, err
+	}
+	if authData.credential.ID == nil {
+		return Credential{}, ErrInvalidAuthData
+	}
+
+	_, err = parsePublicKey(authData.credential.PublicKey)
+	if err != nil {
+		return Credential{}, err
+	}
+
+	return authData.credential, nil
+}
+
+// VerifyAssertion checks the response to a navigator.credentials.get call
+// made with challenge against the stored credential and returns the new
+// sign count to store.
+func (rp RelyingParty) VerifyAssertion(challenge []byte, credential Credential, clientDataJSON, authenticatorData, signature []byte, requireUserVerification bool) (uint32, error) {
+	err := rp.verifyClientData(ceremonyGet, challenge, clientDataJSON)
+	if err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.parseAuthData(authenticatorData, requireUserVerification)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return 0, ErrInvalidSignature
+	}
+
+	// Authenticators that do not keep a counter always report zero.
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, ErrSignCountRegressed
+	}
+
+	return authData.signCount, nil
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func (rp RelyingParty) verifyClientData(ceremony string, challenge, clientDataJSON []byte) error {
+	var data clientData
+	err := json.Unmarshal(clientDataJSON, &data)
+	if err != nil || data.Type != ceremony {
+		return ErrInvalidClientData
+	}
+
+	got, err := base64.RawURLEncoding.DecodeString(data.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(got, challenge) != 1 {
+		return ErrChallengeMismatch
+	}
+	if data.Origin != rp.Origin {
+		return ErrOriginMismatch
+	}
+	return nil
+}
+
+type authenticatorData struct {
+	flags      byte
+	signCount  uint32
+	credential Credential
+}
+
+func (rp RelyingParty) parseAuthData(data []byte, requireUserVerification bool) (authenticatorData, error) {
+	if len(data) < 37 {
+		return authenticatorData{}, ErrInvalidAuthData
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data[:32], rpIDHash[:]) {
+		return authenticatorData{}, ErrRPIDMismatch
+	}
+
+	result := authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if result.flags&flagUserPresent == 0 {
+		return authenticatorData{}, ErrUserNotPresent
+	}
+	if requireUserVerification && result.flags&flagUserVerified == 0 {
+		return authenticatorData{}, ErrUserNotVerified
+	}
+
+	rest := data[37:]
+	if result.flags&flagAttestedData != 0 {
+		// AAGUID (16 bytes), credential id length (2 bytes), credential id,
+		// then the COSE public key.
+		if len(rest) < 18 {
+			return authenticatorData{}, ErrInvalidAuthData
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if idLen == 0 || len(rest) < idLen {
+			return authenticatorData{}, ErrInvalidAuthData
+		}
+		id := append([]byte(nil), rest[:idLen]...)
+		rest = rest[idLen:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, ErrInvalidAuthData
+		}
+		result.credential = Credential{
+			ID:        id,
+			PublicKey: append([]byte(nil), rest[:len(rest)-len(after)]...),
+			SignCount: result.signCount,
+		}
+		rest = after
+	}
+	if result.flags&flagExtensions != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return authenticatorData{}, ErrInvalidAuthData
+		}
+		rest = after
+	}
+	if len(rest) != 0 {
+		return authenticatorData{}, ErrInvalidAuthData
+	}
+
+	return result, nil
+}
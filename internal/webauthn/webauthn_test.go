@@ -0,0 +1,326 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// softAuthenticator is an in-memory authenticator for tests.
+type softAuthenticator struct {
+	rpID         string
+	origin       string
+	credentialID []byte
+	signer       crypto.Signer
+	signCount    uint32
+	userVerified bool
+}
+
+func newSoftAuthenticator(t *testing.T, rp RelyingParty, alg int64) *softAuthenticator {
+	t.Helper()
+
+	var signer crypto.Signer
+	var err error
+	switch alg {
+	case AlgES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		t.Fatalf("unsupported algorithm %d", alg)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{rpID: rp.ID, origin: rp.Origin, credentialID: id, signer: signer, userVerified: true}
+}
+
+func (a *softAuthenticator) coseKey() []byte {
+	switch key := a.signer.Public().(type) {
+	case *ecdsa.PublicKey:
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		key.X.FillBytes(x)
+		key.Y.FillBytes(y)
+		return encodeCBOR(map[int64]any{coseKty: coseKtyEC2, coseAlg: AlgES256, coseCrv: coseCrvP256, coseX: x, coseY: y})
+	case ed25519.PublicKey:
+		return encodeCBOR(map[int64]any{coseKty: coseKtyOKP, coseAlg: AlgEdDSA, coseCrv: coseCrvEd25519, coseX: []byte(key)})
+	}
+	panic("unsupported key")
+}
+
+func (a *softAuthenticator) authData(attested bool) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+	flags := byte(flagUserPresent)
+	if a.userVerified {
+		flags |= flagUserVerified
+	}
+	if attested {
+		flags |= flagAttestedData
+	}
+
+	data := append([]byte(nil), rpIDHash[:]...)
+	data = append(data, flags)
+	data = binary.BigEndian.AppendUint32(data, a.signCount)
+	if attested {
+		data = append(data, make([]byte, 16)...)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(a.credentialID)))
+		data = append(data, a.credentialID...)
+		data = append(data, a.coseKey()...)
+	}
+	return data
+}
+
+func (a *softAuthenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// create answers navigator.credentials.create.
+func (a *softAuthenticator) create(challenge []byte) (clientDataJSON, attestationObject []byte) {
+	attestationObject = encodeCBOR(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(true),
+	})
+	return a.clientData(ceremonyCreate, challenge), attestationObject
+}
+
+// get answers navigator.credentials.get.
+func (a *softAuthenticator) get(t *testing.T, challenge []byte) (clientDataJSON, authenticatorData, signature []byte) {
+	t.Helper()
+
+	a.signCount++
+	clientDataJSON = a.clientData(ceremonyGet, challenge)
+	authenticatorData = a.authData(false)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte(nil), authenticatorData...), clientDataHash[:]...)
+
+	var err error
+	switch signer := a.signer.(type) {
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(signed)
+		signature, err = ecdsa.SignASN1(rand.Reader, signer, digest[:])
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(signer, signed)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return clientDataJSON, authenticatorData, signature
+}
+
+func encodeCBOR(v any) []byte {
+	header := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		}
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+
+	switch v := v.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return header(1, uint64(-1-v))
+		}
+		return header(0, uint64(v))
+	case []byte:
+		return append(header(2, uint64(len(v))), v...)
+	case string:
+		return append(header(3, uint64(len(v))), v...)
+	case map[int64]any:
+		out := header(5, uint64(len(v)))
+		for key, value := range v {
+			out = append(out, encodeCBOR(key)...)
+			out = append(out, encodeCBOR(value)...)
+		}
+		return out
+	case map[string]any:
+		out := header(5, uint64(len(v)))
+		for key, value := range v {
+			out = append(out, encodeCBOR(key)...)
+			out = append(out, encodeCBOR(value)...)
+		}
+		return out
+	}
+	panic("unsupported cbor value")
+}
+
+func testRelyingParty(t *testing.T) RelyingParty {
+	t.Helper()
+
+	rp, err := NewRelyingParty("Chirpy", "https://chirpy.example:8443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rp.ID != "chirpy.example" || rp.Origin != "https://chirpy.example:8443" {
+		t.Fatalf("unexpected relying party %+v", rp)
+	}
+	return rp
+}
+
+func TestRegisterAndLogin(t *testing.T) {
+	rp := testRelyingParty(t)
+
+	for _, alg := range []int64{AlgES256, AlgEdDSA} {
+		authenticator := newSoftAuthenticator(t, rp, alg)
+
+		challenge, err := NewChallenge()
+		if err != nil {
+			t.Fatal(err)
+		}
+		clientDataJSON, attestationObject := authenticator.create(challenge)
+		credential, err := rp.VerifyRegistration(challenge, clientDataJSON, attestationObject, true)
+		if err != nil {
+			t.Fatalf("alg %d: VerifyRegistration: %v", alg, err)
+		}
+		if string(credential.ID) != string(authenticator.credentialID) {
+			t.Fatalf("alg %d: credential id = %x, want %x", alg, credential.ID, authenticator.credentialID)
+		}
+
+		for range 2 {
+			challenge, _ = NewChallenge()
+			clientDataJSON, authData, signature := authenticator.get(t, challenge)
+			signCount, err := rp.VerifyAssertion(challenge, credential, clientDataJSON, authData, signature, true)
+			if err != nil {
+				t.Fatalf("alg %d: VerifyAssertion: %v", alg, err)
+			}
+			if signCount != authenticator.signCount {
+				t.Fatalf("alg %d: sign count = %d, want %d", alg, signCount, authenticator.signCount)
+			}
+			credential.SignCount = signCount
+		}
+	}
+}
+
+func TestVerifyAssertionRejects(t *testing.T) {
+	rp := testRelyingParty(t)
+	authenticator := newSoftAuthenticator(t, rp, AlgES256)
+
+	challenge, _ := NewChallenge()
+	clientDataJSON, attestationObject := authenticator.create(challenge)
+	credential, err := rp.VerifyRegistration(challenge, clientDataJSON, attestationObject, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential.SignCount = 5
+
+	otherChallenge, _ := NewChallenge()
+	otherRP := rp
+	otherRP.Origin = "https://evil.example"
+
+	tests := []struct {
+		name    string
+		rp      RelyingParty
+		prepare func()
+		mutate  func(clientDataJSON, authData, signature []byte) ([]byte, []byte, []byte)
+		want    error
+	}{
+		{
+			name: "wrong challenge",
+			rp:   rp,
+			mutate: func(c, a, s []byte) ([]byte, []byte, []byte) {
+				return authenticator.clientData(ceremonyGet, otherChallenge), a, s
+			},
+			want: ErrChallengeMismatch,
+		},
+		{
+			name: "wrong ceremony",
+			rp:   rp,
+			mutate: func(c, a, s []byte) ([]byte, []byte, []byte) {
+				return authenticator.clientData(ceremonyCreate, challenge), a, s
+			},
+			want: ErrInvalidClientData,
+		},
+		{
+			name: "phishing origin",
+			rp:   otherRP,
+			want: ErrOriginMismatch,
+		},
+		{
+			name: "tampered signature",
+			rp:   rp,
+			mutate: func(c, a, s []byte) ([]byte, []byte, []byte) {
+				s[len(s)-1] ^= 0xff
+				return c, a, s
+			},
+			want: ErrInvalidSignature,
+		},
+		{
+			name:    "cloned authenticator",
+			rp:      rp,
+			prepare: func() { authenticator.signCount = 2 },
+			want:    ErrSignCountRegressed,
+		},
+		{
+			name:    "user not verified",
+			rp:      rp,
+			prepare: func() { authenticator.userVerified = false },
+			want:    ErrUserNotVerified,
+		},
+	}
+
+	for _, tt := range tests {
+		authenticator.signCount = 10
+		authenticator.userVerified = true
+		if tt.prepare != nil {
+			tt.prepare()
+		}
+
+		clientDataJSON, authData, signature := authenticator.get(t, challenge)
+		if tt.mutate != nil {
+			clientDataJSON, authData, signature = tt.mutate(clientDataJSON, authData, signature)
+		}
+		_, err := tt.rp.VerifyAssertion(challenge, credential, clientDataJSON, authData, signature, true)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestVerifyRegistrationRejectsOtherRPID(t *testing.T) {
+	rp := testRelyingParty(t)
+	authenticator := newSoftAuthenticator(t, rp, AlgES256)
+	authenticator.rpID = "evil.example"
+
+	challenge, _ := NewChallenge()
+	clientDataJSON, attestationObject := authenticator.create(challenge)
+	_, err := rp.VerifyRegistration(challenge, clientDataJSON, attestationObject, true)
+	if !errors.Is(err, ErrRPIDMismatch) {
+		t.Fatalf("err = %v, want %v", err, ErrRPIDMismatch)
+	}
+}
+
+func TestDecodeCBORRejectsTruncatedInput(t *testing.T) {
+	data := encodeCBOR(map[string]any{"authData": make([]byte, 64)})
+	for i := range len(data) {
+		_, _, err := decodeCBOR(data[:i])
+		if err == nil {
+			t.Fatalf("decoding %d of %d bytes succeeded", i, len(data))
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var errUnknownServiceKey = errors.New("unknown service api key")
+
+// loadServiceKeys parses SERVICE_API_KEYS, a comma separated list of
+// name=key entries for the internal services allowed to introspect tokens.
+func loadServiceKeys(keysEnv string) (auth.ServiceKeys, error) {
+	keys, err := auth.ParseServiceKeys(keysEnv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SERVICE_API_KEYS: %w", err)
+	}
+	return keys, nil
+}
+
+// authenticateService returns the name of the service whose API key r
+// carries.
+func (cfg *apiConfig) authenticateService(r *http.Request) (string, error) {
+	apiKey, err := auth.GetAPIKey(r.Header)
+	if err != nil {
+		return "", err
+	}
+
+	service, ok := cfg.serviceKeys.Lookup(apiKey)
+	if !ok {
+		return "", errUnknownServiceKey
+	}
+	return service, nil
+}
+
+// introspectionResponse is the RFC 7662 description of a token. Inactive
+// tokens are described by Active alone.
+type introspectionResponse struct {
+	Active    bool               `json:"active"`
+	TokenType string             `json:"token_type,omitempty"`
+	Scope     string             `json:"scope,omitempty"`
+	ClientID  string             `json:"client_id,omitempty"`
+	Subject   string             `json:"sub,omitempty"`
+	Issuer    string             `json:"iss,omitempty"`
+	IssuedAt  int64              `json:"iat,omitempty"`
+	ExpiresAt int64              `json:"exp,omitempty"`
+	JTI       string             `json:"jti,omitempty"`
+	Cnf       *auth.Confirmation `json:"cnf,omitempty"`
+}
+
+// introspectToken tells internal services whether an access token,
+// personal access token or refresh token is active. Login sessions are not
+// limited by scope, so they are described with every scope.
+func (cfg *apiConfig) introspectToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+
+	service, err := cfg.authenticateService(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "ApiKey")
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		writeErrorJson(w, errors.New("token is required"), "Token is required")
+		return
+	}
+
+	// The kind of token is told by its shape, so token_type_hint is not
+	// needed.
+	var resp introspectionResponse
+	switch auth.KindOfToken(token) {
+	case auth.KindPersonalAccessToken:
+		resp = cfg.introspectPersonalAccessToken(r, token)
+	case auth.KindAccessToken:
+		resp = cfg.introspectAccessToken(token)
+	default:
+		resp = cfg.introspectRefreshToken(r, token)
+	}
+
+	if resp.Active {
+		log.Printf("Service %s introspected a token of user %s", service, resp.Subject)
+	}
+	writeSuccessJson(w, resp)
+}
+
+func (cfg *apiConfig) introspectAccessToken(token string) introspectionResponse {
+	claims, err := auth.ParseJWT(token, cfg.keys, cfg.jwtOptions)
+	if err != nil {
+		return introspectionResponse{}
+	}
+	if cfg.denylist.IsRevoked(claims.ID) || (claims.SessionID != "" && cfg.denylist.IsRevoked(claims.SessionID)) {
+		return introspectionResponse{}
+	}
+
+	resp := introspectionResponse{
+		Active:    true,
+		TokenType: "Bearer",
+		Scope:     strings.Join(auth.Scopes, " "),
+		ClientID:  claims.ClientID,
+		Subject:   claims.Subject,
+		Issuer:    claims.Issuer,
+		IssuedAt:  claims.IssuedAt.Unix(),
+		ExpiresAt: claims.ExpiresAt.Unix(),
+		JTI:       claims.ID,
+	}
+	if claims.Delegated() {
+		resp.Scope = claims.Scope
+	}
+	if jkt := claims.DPoPThumbprint(); jkt != "" {
+		resp.TokenType = "DPoP"
+		resp.Cnf = &auth.Confirmation{JKT: jkt}
+	}
+	return resp
+}
+
+func (cfg *apiConfig) introspectPersonalAccessToken(r *http.Request, token string) introspectionResponse {
+	pat, err := cfg.sql.GetPersonalAccessTokenByHash(r.Context(), auth.HashToken(token))
+	if err != nil {
+		return introspectionResponse{}
+	}
+
+	resp := introspectionResponse{
+		Active:    true,
+		TokenType: "Bearer",
+		Scope:     strings.Join(pat.Scopes, " "),
+		Subject:   pat.UserID.String(),
+		Issuer:    auth.Issuer,
+		IssuedAt:  pat.CreatedAt.Unix(),
+	}
+	if pat.ExpiresAt.Valid {
+		resp.ExpiresAt = pat.ExpiresAt.Time.Unix()
+	}
+	return resp
+}
+
+func (cfg *apiConfig) introspectRefreshToken(r *http.Request, token string) introspectionResponse {
+	refreshToken, err := cfg.sql.GetRefreshTokenByHash(r.Context(), auth.HashToken(token))
+	if err != nil || refreshToken.ExpiresAt.Before(time.Now()) {
+		return introspectionResponse{}
+	}
+
+	resp := introspectionResponse{
+		Active:    true,
+		TokenType: "refresh_token",
+		Scope:     strings.Join(auth.Scopes, " "),
+		Subject:   refreshToken.UserID.String(),
+		Issuer:    auth.Issuer,
+		IssuedAt:  refreshToken.CreatedAt.Unix(),
+		ExpiresAt: refreshToken.ExpiresAt.Unix(),
+	}
+	if refreshToken.ClientID.Valid {
+		resp.ClientID = refreshToken.ClientID.UUID.String()
+		resp.Scope = strings.Join(refreshToken.Scopes, " ")
+	}
+	if refreshToken.DpopJkt != "" {
+		resp.Cnf = &auth.Confirmation{JKT: refreshToken.DpopJkt}
+	}
+	return resp
+}
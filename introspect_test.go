@@ -0,0 +1,105 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+const testServiceKey = "a-service-api-key-that-is-long-enough"
+
+// introspect asks the introspection endpoint about token with apiKey.
+func introspect(cfg *apiConfig, apiKey, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/introspect", strings.NewReader(url.Values{"token": {token}}.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if apiKey != "" {
+		r.Header.Set("Authorization", "ApiKey "+apiKey)
+	}
+	return serve(cfg.introspectToken, r)
+}
+
+func TestIntrospectToken(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	cfg.serviceKeys = auth.ServiceKeys{"billing": testServiceKey}
+	createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+	endedSession := loginTestUser(t, cfg, "alice@example.com")
+	pat := createTestPAT(t, cfg, session.Token, auth.ScopeChirpsRead)
+
+	rr := serve(cfg.createPersonalAccessToken, withBearer(newJSONRequest(http.MethodPost, "/api/tokens", map[string]any{
+		"name":   "revoked",
+		"scopes": []string{auth.ScopeChirpsRead},
+	}), session.Token))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("creating personal access token: status %d, body %s", rr.Code, rr.Body)
+	}
+	revokedPAT := decodeBody[personalAccessTokenResponse](t, rr)
+	r := withBearer(newJSONRequest(http.MethodDelete, "/api/tokens/"+revokedPAT.ID.String(), nil), session.Token)
+	r.SetPathValue("tokenID", revokedPAT.ID.String())
+	if rr := serve(cfg.deletePersonalAccessToken, r); rr.Code != http.StatusNoContent {
+		t.Fatalf("revoking personal access token: status %d, body %s", rr.Code, rr.Body)
+	}
+
+	// Ending a session denylists its id rather than each access token.
+	claims, err := auth.ParseJWT(endedSession.Token, cfg.keys, cfg.jwtOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = withBearer(newJSONRequest(http.MethodDelete, "/api/sessions/"+claims.SessionID, nil), session.Token)
+	r.SetPathValue("sessionID", claims.SessionID)
+	if rr := serve(cfg.deleteSession, r); rr.Code != http.StatusNoContent {
+		t.Fatalf("ending session: status %d, body %s", rr.Code, rr.Body)
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		wantType  string
+		wantScope string
+	}{
+		{"access token", session.Token, "Bearer", strings.Join(auth.Scopes, " ")},
+		{"refresh token", session.RefreshToken, "refresh_token", strings.Join(auth.Scopes, " ")},
+		{"personal access token", pat, "Bearer", auth.ScopeChirpsRead},
+		{"access token of an ended session", endedSession.Token, "", ""},
+		{"refresh token of an ended session", endedSession.RefreshToken, "", ""},
+		{"revoked personal access token", revokedPAT.Token, "", ""},
+		{"unknown token", "not-a-token", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := introspect(cfg, testServiceKey, tt.token)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("status %d, body %s", rr.Code, rr.Body)
+			}
+			resp := decodeBody[introspectionResponse](t, rr)
+			if resp.Active != (tt.wantType != "") || resp.TokenType != tt.wantType || resp.Scope != tt.wantScope {
+				t.Errorf("introspection = %+v, want type %q and scope %q", resp, tt.wantType, tt.wantScope)
+			}
+		})
+	}
+}
+
+func TestIntrospectTokenRejectsUnknownServices(t *testing.T) {
+	cfg := newTestConfigWithoutDB(t)
+	cfg.serviceKeys = auth.ServiceKeys{"billing": testServiceKey}
+	token, err := auth.MakeJWT(uuid.New(), uuid.New(), auth.RoleUser, cfg.keys, accessTokenDuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, apiKey := range []string{"", "a-guessed-api-key-that-is-long-enough", strings.ToUpper(testServiceKey)} {
+		rr := introspect(cfg, apiKey, token)
+		if rr.Code != http.StatusUnauthorized || rr.Header().Get("WWW-Authenticate") != "ApiKey" {
+			t.Errorf("api key %q: status %d, WWW-Authenticate %q", apiKey, rr.Code, rr.Header().Get("WWW-Authenticate"))
+		}
+		if strings.Contains(rr.Body.String(), `"active"`) {
+			t.Errorf("api key %q: the token was described", apiKey)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// loadKeyring builds the JWT keyring from JWT_KEYS, a comma separated list
+// of kid=path pairs pointing at PEM files, and JWT_SIGNING_KEY_ID, the kid
+// new tokens are signed with. Every other key is only used to verify
+// tokens, which is how an old key is phased out after a rotation. Without
+// JWT_KEYS tokens are signed with HS256 using the shared secret.
+func loadKeyring(keysEnv, signingKeyID, secret string) (*auth.Keyring, error) {
+	if strings.TrimSpace(keysEnv) == "" {
+		return auth.NewKeyring(auth.NewHMACKey("default", []byte(secret)))
+	}
+
+	var signing *auth.Key
+	var verify []*auth.Key
+	for _, entry := range strings.Split(keysEnv, ",") {
+		kid, path, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || kid == "" || path == "" {
+			return nil, fmt.Errorf("invalid JWT_KEYS entry %q", entry)
+		}
+
+		key, err := auth.LoadKeyFile(kid, path)
+		if err != nil {
+			return nil, fmt.Errorf("loading key %q: %w", kid, err)
+		}
+
+		if kid == signingKeyID {
+			signing = key
+		} else {
+			verify = append(verify, key)
+		}
+	}
+
+	if signing == nil {
+		return nil, errors.New("JWT_SIGNING_KEY_ID must name one of JWT_KEYS")
+	}
+
+	return auth.NewKeyring(signing, verify...)
+}
+
+func (cfg *apiConfig) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+
+	writeSuccessJson(w, cfg.keys.JWKS())
+}
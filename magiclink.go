@@ -0,0 +1,198 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/account"
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/mailer"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	magicLinkPurpose  = "magic-link"
+	magicLinkDuration = 15 * time.Minute
+	// magicLinkNonceCookie binds a magic link to the browser that asked for
+	// it, so a link forwarded to or intercepted by someone else is useless.
+	magicLinkNonceCookie = "chirpy_magic_nonce"
+)
+
+func magicLinkThrottleKey(email string) string {
+	return "magic:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func magicLinkIPThrottleKey(ip string) string {
+	return "magic-ip:" + ip
+}
+
+// requestMagicLink emails a single use login link. Every request counts
+// against the throttle of the address and the client, so the endpoint
+// cannot be used to flood someone's inbox. It only takes JSON, so that
+// another site cannot plant a nonce for a link to its own account in the
+// browser.
+func (cfg *apiConfig) requestMagicLink(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	err := checkCookieLogin(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		writeErrorJson(w, err, "Send the request as JSON")
+		return
+	}
+
+	type parameters struct {
+		Email      string `json:"email"`
+		UseCookies bool   `json:"use_cookies"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	email := strings.TrimSpace(params.Email)
+	if !account.ValidEmail(email) {
+		writeErrorJson(w, errors.New("email is invalid"), "Email is invalid")
+		return
+	}
+
+	throttleKeys := []string{magicLinkThrottleKey(email), magicLinkIPThrottleKey(cfg.clientIP(r))}
+	retryAfter, err := cfg.recordLoginAttempt(r.Context(), throttleKeys...)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter)
+		return
+	}
+
+	nonce, err := auth.MakeRefreshToken()
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	// The nonce is set whether or not the account exists, so the response
+	// does not tell.
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkNonceCookie,
+		Value:    nonce,
+		Path:     "/api/login/magic",
+		MaxAge:   int(magicLinkDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	user, err := cfg.sql.GetUserByEmail(r.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeSuccessJson(w, nil, http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	link, err := cfg.sql.CreateMagicLink(r.Context(), database.CreateMagicLinkParams{
+		UserID:     user.ID,
+		NonceHash:  auth.HashToken(nonce),
+		UseCookies: params.UseCookies,
+		ExpiresAt:  time.Now().Add(magicLinkDuration),
+	})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	token := auth.MakeSignedToken(cfg.secret, magicLinkPurpose, link.ID.String(), magicLinkDuration)
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your Chirpy login link",
+		Body:    fmt.Sprintf("To log in to Chirpy, open this link in the same browser within the next 15 minutes:\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n", cfg.baseURL+"/api/login/magic/verify?token="+url.QueryEscape(token)),
+	})
+
+	writeSuccessJson(w, nil, http.StatusAccepted)
+}
+
+// verifyMagicLink logs the user in like createSession when the link is
+// opened in the browser that requested it.
+func (cfg *apiConfig) verifyMagicLink(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	throttleKey := magicLinkIPThrottleKey(cfg.clientIP(r))
+	retryAfter, err := cfg.recordLoginAttempt(r.Context(), throttleKey)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter)
+		return
+	}
+
+	link, err := cfg.consumeMagicLink(r)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, err, "Invalid or expired link, or opened in another browser")
+		return
+	}
+
+	user, err := cfg.sql.GetUserByID(r.Context(), link.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+
+	cfg.refundLoginAttempt(r.Context(), throttleKey)
+	cfg.clearLoginFailures(r.Context(), magicLinkThrottleKey(user.Email))
+	http.SetCookie(w, &http.Cookie{
+		Name:     magicLinkNonceCookie,
+		Path:     "/api/login/magic",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cfg.secureCookies,
+	})
+
+	cfg.completeLogin(w, r, user, link.UseCookies)
+}
+
+// consumeMagicLink checks the token and browser nonce of a magic link
+// request and marks the link used.
+func (cfg *apiConfig) consumeMagicLink(r *http.Request) (database.MagicLink, error) {
+	data, err := auth.VerifySignedToken(cfg.secret, magicLinkPurpose, r.URL.Query().Get("token"))
+	if err != nil {
+		return database.MagicLink{}, err
+	}
+
+	linkID, err := uuid.Parse(data)
+	if err != nil {
+		return database.MagicLink{}, err
+	}
+
+	nonce, err := r.Cookie(magicLinkNonceCookie)
+	if err != nil {
+		return database.MagicLink{}, errors.New("magic link nonce cookie missing")
+	}
+
+	return cfg.sql.ConsumeMagicLink(r.Context(), database.ConsumeMagicLinkParams{
+		ID:        linkID,
+		NonceHash: auth.HashToken(nonce.Value),
+	})
+}
+
+func (cfg *apiConfig) pruneMagicLinks(ctx context.Context) error {
+	return cfg.sql.DeleteExpiredMagicLinks(ctx, time.Now())
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// requestMagicLinkFor asks for a magic link for email and returns the nonce
+// cookie set in the browser.
+func requestMagicLinkFor(t *testing.T, cfg *apiConfig, email string) *http.Cookie {
+	t.Helper()
+
+	rr := serve(cfg.requestMagicLink, newJSONRequest(http.MethodPost, "/api/login/magic", map[string]any{
+		"email": email,
+	}))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("requesting magic link: status %d, body %s", rr.Code, rr.Body)
+	}
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == magicLinkNonceCookie {
+			return cookie
+		}
+	}
+	t.Fatal("no nonce cookie was set")
+	return nil
+}
+
+// openMagicLink opens link in a browser holding nonce.
+func openMagicLink(cfg *apiConfig, link string, nonce *http.Cookie) int {
+	r := httptest.NewRequest(http.MethodGet, strings.TrimPrefix(link, testBaseURL), nil)
+	if nonce != nil {
+		r.AddCookie(nonce)
+	}
+	return serve(cfg.verifyMagicLink, r).Code
+}
+
+func TestMagicLinkRequestMustBeJSON(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+
+	r := httptest.NewRequest(http.MethodPost, "/api/login/magic", strings.NewReader(`{"email": "alice@example.com"}`))
+	r.Header.Set("Content-Type", "text/plain")
+	rr := serve(cfg.requestMagicLink, r)
+	if rr.Code != http.StatusUnsupportedMediaType {
+		t.Fatalf("status %d, want %d", rr.Code, http.StatusUnsupportedMediaType)
+	}
+	if len(rr.Result().Cookies()) != 0 {
+		t.Error("a nonce cookie was set")
+	}
+}
+
+func TestMagicLinkIsBoundToBrowser(t *testing.T) {
+	cfg, mail := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+
+	nonce := requestMagicLinkFor(t, cfg, "alice@example.com")
+	link := mail.link(t)
+
+	if status := openMagicLink(cfg, link, nil); status != http.StatusUnauthorized {
+		t.Errorf("without nonce: status %d, want %d", status, http.StatusUnauthorized)
+	}
+	other := &http.Cookie{Name: magicLinkNonceCookie, Value: "someone-elses-nonce"}
+	if status := openMagicLink(cfg, link, other); status != http.StatusUnauthorized {
+		t.Errorf("other nonce: status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	// Failed attempts don't use up the link.
+	if status := openMagicLink(cfg, link, nonce); status != http.StatusOK {
+		t.Fatalf("requesting browser: status %d, want %d", status, http.StatusOK)
+	}
+	if status := openMagicLink(cfg, link, nonce); status != http.StatusUnauthorized {
+		t.Errorf("second use: status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestMagicLinkThrottle(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+
+	for range cfg.loginPolicy.FreeAttempts + 1 {
+		requestMagicLinkFor(t, cfg, "alice@example.com")
+	}
+
+	rr := serve(cfg.requestMagicLink, newJSONRequest(http.MethodPost, "/api/login/magic", map[string]any{
+		"email": "alice@example.com",
+	}))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if len(rr.Result().Cookies()) != 0 {
+		t.Error("a throttled request set a nonce cookie")
+	}
+}
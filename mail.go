@@ -0,0 +1,54 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/mailer"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// newMailer picks the mail transport from MAILER: "smtp" delivers through
+// SMTP_HOST, "file" appends to MAIL_FILE and anything else prints to stdout.
+func newMailer() (mailer.Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Chirpy <no-reply@localhost>"
+	}
+
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return nil, fmt.Errorf("SMTP_HOST must be set")
+		}
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return mailer.NewSMTPMailer(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from), nil
+	case "file":
+		path := os.Getenv("MAIL_FILE")
+		if path == "" {
+			return nil, fmt.Errorf("MAIL_FILE must be set")
+		}
+		return mailer.NewFileMailer(path, from)
+	default:
+		return mailer.NewWriterMailer(os.Stdout, from), nil
+	}
+}
+
+// sendMail delivers msg in the background so that response times do not
+// reveal whether an email was sent.
+func (cfg *apiConfig) sendMail(msg mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		err := cfg.mailer.Send(ctx, msg)
+		if err != nil {
+			log.Printf("Error sending mail to %s: %s", msg.To, err)
+		}
+	}()
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"codingiam/chirpy/internal/auth"
 	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/mailer"
+	"codingiam/chirpy/internal/oidc"
+	"codingiam/chirpy/internal/throttle"
+	"codingiam/chirpy/internal/webauthn"
+	"context"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -14,10 +22,32 @@ import (
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db             *sql.DB
 	sql            *database.Queries
 	platform       string
 	secret         string
+	keys           *auth.Keyring
+	jwtOptions     auth.ValidationOptions
+	challengeOpts  auth.ValidationOptions
+	denylist       *auth.Denylist
+	dpopReplay     *auth.ReplayCache
 	polkaKey       string
+	baseURL        string
+	mailer         mailer.Mailer
+	passwords      auth.PasswordHasher
+	loginPolicy    throttle.Policy
+	deletionGrace  time.Duration
+	adminKey       string
+	serviceKeys    auth.ServiceKeys
+	trustProxy     bool
+	relyingParty   webauthn.RelyingParty
+	ssoProviders   map[string]*oidc.Provider
+
+	// secureCookies marks session cookies Secure when served over https.
+	secureCookies bool
+
+	// requireVerifiedEmail blocks chirping until the email is verified.
+	requireVerifiedEmail bool
 }
 
 func main() {
@@ -39,6 +69,11 @@ func main() {
 		log.Fatal("SECRET must be set")
 	}
 
+	keys, err := loadKeyring(os.Getenv("JWT_KEYS"), os.Getenv("JWT_SIGNING_KEY_ID"), secret)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	dbURL := os.Getenv("DB_URL")
 	if dbURL == "" {
 		log.Fatal("DB_URL must be set")
@@ -49,6 +84,46 @@ func main() {
 		log.Fatal("POLKA_KEY must be set")
 	}
 
+	baseURL := strings.TrimSuffix(os.Getenv("BASE_URL"), "/")
+	if baseURL == "" {
+		baseURL = "http://localhost:" + port
+	}
+
+	mailSender, err := newMailer()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	passwords, err := loadPasswordHasher()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	loginPolicy, err := loadLoginPolicy()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	deletionGrace, err := loadDeletionGracePeriod()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	relyingParty, err := webauthn.NewRelyingParty("Chirpy", baseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	serviceKeys, err := loadServiceKeys(os.Getenv("SERVICE_API_KEYS"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ssoProviders, err := loadOIDCProviders(baseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatal(err)
@@ -56,25 +131,114 @@ func main() {
 
 	dbQueries := database.New(db)
 
+	denylist := auth.NewDenylist(denylistStore{sql: dbQueries})
+	err = denylist.Sync(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	go denylist.Run(context.Background(), time.Minute)
+
 	cfg := &apiConfig{
-		fileserverHits: atomic.Int32{},
-		sql:            dbQueries,
-		platform:       platform,
-		secret:         secret,
-		polkaKey:       polkaKey,
+		fileserverHits:       atomic.Int32{},
+		db:                   db,
+		sql:                  dbQueries,
+		platform:             platform,
+		secret:               secret,
+		keys:                 keys,
+		jwtOptions:           auth.AccessTokenOptions(keys),
+		challengeOpts:        auth.ChallengeTokenOptions(keys),
+		denylist:             denylist,
+		dpopReplay:           auth.NewReplayCache(),
+		polkaKey:             polkaKey,
+		baseURL:              baseURL,
+		mailer:               mailSender,
+		passwords:            passwords,
+		loginPolicy:          loginPolicy,
+		deletionGrace:        deletionGrace,
+		adminKey:             os.Getenv("ADMIN_API_KEY"),
+		serviceKeys:          serviceKeys,
+		trustProxy:           os.Getenv("TRUST_PROXY") == "true",
+		relyingParty:         relyingParty,
+		ssoProviders:         ssoProviders,
+		secureCookies:        strings.HasPrefix(baseURL, "https://"),
+		requireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
 	}
 
+	go runPeriodically(context.Background(), time.Hour, "login attempt pruning", cfg.pruneLoginAttempts)
+	go runPeriodically(context.Background(), time.Hour, "authorization code pruning", cfg.pruneOAuthAuthorizationCodes)
+	go runPeriodically(context.Background(), time.Hour, "magic link pruning", cfg.pruneMagicLinks)
+	go runPeriodically(context.Background(), time.Hour, "passkey challenge pruning", cfg.prunePasskeyChallenges)
+	go runPeriodically(context.Background(), time.Minute, "dpop replay cache pruning", cfg.pruneDPoPReplayCache)
+	go runPeriodically(context.Background(), time.Hour, "deleted account purging", cfg.purgeDeletedUsers)
+	go runPeriodically(context.Background(), time.Minute, "data export building", cfg.runDataExports)
+	go runPeriodically(context.Background(), time.Hour, "data export pruning", cfg.pruneDataExports)
+	go runPeriodically(context.Background(), time.Hour, "email change pruning", cfg.pruneEmailChanges)
+	go runPeriodically(context.Background(), time.Minute, "released handle notices", cfg.notifyReleasedHandles)
+
 	mux := http.NewServeMux()
 
 	handler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", cfg.middlewareMetricsInc(handler))
 
 	mux.HandleFunc("GET /api/healthz", healthz)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.jwksHandler)
 
 	mux.HandleFunc("POST /api/users", cfg.createUser)
 	mux.HandleFunc("PUT /api/users", cfg.updateUser)
+	mux.HandleFunc("PATCH /api/users", cfg.patchUser)
+	mux.HandleFunc("DELETE /api/users", cfg.deleteUser)
+	mux.HandleFunc("POST /api/users/export", cfg.createDataExport)
+	mux.HandleFunc("GET /api/users/export/{exportID}", cfg.showDataExport)
+	mux.HandleFunc("GET /api/users/export/download", cfg.downloadDataExport)
+	mux.HandleFunc("PUT /api/users/profile", cfg.updateProfile)
+	mux.HandleFunc("GET /api/users/{handleOrID}", cfg.showUser)
+
+	mux.HandleFunc("GET /api/users/verify", cfg.verifyEmail)
+	mux.HandleFunc("GET /api/users/email/confirm", cfg.confirmEmailChange)
+	mux.HandleFunc("GET /api/users/email/revert", cfg.showEmailRevert)
+	mux.HandleFunc("POST /api/users/email/revert", cfg.revertEmailChange)
+	mux.HandleFunc("POST /api/users/verify/resend", cfg.resendVerification)
+
+	mux.HandleFunc("POST /api/users/2fa", cfg.enrollTwoFactor)
+	mux.HandleFunc("POST /api/users/2fa/confirm", cfg.confirmTwoFactor)
+	mux.HandleFunc("DELETE /api/users/2fa", cfg.disableTwoFactor)
+
+	mux.HandleFunc("POST /api/tokens", cfg.createPersonalAccessToken)
+	mux.HandleFunc("GET /api/tokens", cfg.indexPersonalAccessTokens)
+	mux.HandleFunc("DELETE /api/tokens/{tokenID}", cfg.deletePersonalAccessToken)
+
+	mux.HandleFunc("POST /api/oauth/clients", cfg.createOAuthClient)
+	mux.HandleFunc("GET /api/oauth/clients", cfg.indexOAuthClients)
+	mux.HandleFunc("GET /api/oauth/clients/{clientID}", cfg.showOAuthClient)
+	mux.HandleFunc("DELETE /api/oauth/clients/{clientID}", cfg.deleteOAuthClient)
+
+	mux.HandleFunc("GET /oauth/authorize", cfg.authorizeOAuth)
+	mux.HandleFunc("POST /oauth/authorize", cfg.approveOAuth)
+	mux.HandleFunc("POST /oauth/token", cfg.oauthToken)
+	mux.HandleFunc("POST /oauth/introspect", cfg.introspectToken)
+
+	mux.HandleFunc("POST /api/webauthn/register/begin", cfg.beginPasskeyRegistration)
+	mux.HandleFunc("POST /api/webauthn/register/finish", cfg.finishPasskeyRegistration)
+	mux.HandleFunc("GET /api/webauthn/credentials", cfg.indexPasskeys)
+	mux.HandleFunc("DELETE /api/webauthn/credentials/{credentialID}", cfg.deletePasskey)
+	mux.HandleFunc("POST /api/webauthn/login/begin", cfg.beginPasskeyLogin)
+	mux.HandleFunc("POST /api/webauthn/login/finish", cfg.finishPasskeyLogin)
+
+	mux.HandleFunc("GET /api/sso/providers", cfg.indexSSOProviders)
+	mux.HandleFunc("GET /api/sso/{provider}/login", cfg.startSSOLogin)
+	mux.HandleFunc("GET /api/sso/{provider}/callback", cfg.finishSSOLogin)
+
+	mux.HandleFunc("GET /api/sessions", cfg.indexSessions)
+	mux.HandleFunc("DELETE /api/sessions", cfg.deleteOtherSessions)
+	mux.HandleFunc("DELETE /api/sessions/{sessionID}", cfg.deleteSession)
 
 	mux.HandleFunc("POST /api/login", cfg.createSession)
+	mux.HandleFunc("POST /api/login/2fa", cfg.verifyTwoFactorSession)
+	mux.HandleFunc("POST /api/login/magic", cfg.requestMagicLink)
+	mux.HandleFunc("GET /api/login/magic/verify", cfg.verifyMagicLink)
+
+	mux.HandleFunc("POST /api/password/forgot", cfg.forgotPassword)
+	mux.HandleFunc("POST /api/password/reset", cfg.resetPassword)
 	mux.HandleFunc("POST /api/refresh", cfg.refreshSession)
 	mux.HandleFunc("POST /api/revoke", cfg.revokeSession)
 
@@ -85,8 +249,13 @@ func main() {
 
 	mux.HandleFunc("POST /api/polka/webhooks", cfg.polkaWebhook)
 
-	mux.HandleFunc("POST /admin/reset", cfg.resetHandler)
-	mux.HandleFunc("GET /admin/metrics", cfg.metricsHandler)
+	// Every /admin route is for admins only.
+	adminMux := http.NewServeMux()
+	adminMux.HandleFunc("POST /admin/reset", cfg.resetHandler)
+	adminMux.HandleFunc("GET /admin/metrics", cfg.metricsHandler)
+	adminMux.HandleFunc("DELETE /admin/lockouts", cfg.clearLockout)
+	adminMux.HandleFunc("PUT /admin/users/{userID}/role", cfg.updateUserRole)
+	mux.Handle("/admin/", cfg.middlewareRequireRole(auth.RoleAdmin, adminMux))
 
 	log.Printf("Serving on port: %s\n", port)
 	log.Fatal(http.ListenAndServe(":"+port, mux))
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/mailer"
+	"codingiam/chirpy/internal/throttle"
+	"codingiam/chirpy/internal/webauthn"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The handler tests run against the Postgres database in CHIRPY_TEST_DB_URL.
+// Its public schema is dropped and rebuilt from sql/schema, so never point
+// it at a database you care about. Without it they are skipped.
+const testDBEnv = "CHIRPY_TEST_DB_URL"
+
+const (
+	testBaseURL  = "http://chirpy.test"
+	testPassword = "correct horse battery staple"
+)
+
+var (
+	testDBOnce sync.Once
+	testDB     *sql.DB
+	testDBErr  error
+)
+
+// openTestDB connects to the test database and migrates it once per run.
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dbURL := os.Getenv(testDBEnv)
+	if dbURL == "" {
+		t.Skipf("%s is not set", testDBEnv)
+	}
+
+	testDBOnce.Do(func() {
+		testDB, testDBErr = sql.Open("postgres", dbURL)
+		if testDBErr != nil {
+			return
+		}
+		testDBErr = migrateTestDB(testDB)
+	})
+	if testDBErr != nil {
+		t.Fatalf("setting up test database: %s", testDBErr)
+	}
+	return testDB
+}
+
+// migrateTestDB recreates the public schema and runs the up section of
+// every migration in order.
+func migrateTestDB(db *sql.DB) error {
+	_, err := db.Exec("DROP SCHEMA public CASCADE; CREATE SCHEMA public")
+	if err != nil {
+		return err
+	}
+
+	paths, err := filepath.Glob("sql/schema/*.sql")
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		migration, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		up, _, _ := strings.Cut(string(migration), "-- +goose Down")
+		_, err = db.Exec(up)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncateTestDB empties every table between tests.
+func truncateTestDB(t *testing.T, db *sql.DB) {
+	t.Helper()
+
+	_, err := db.Exec(`DO $$
+DECLARE
+    tables TEXT;
+BEGIN
+    SELECT string_agg(format('%I', tablename), ', ') INTO tables
+    FROM pg_tables WHERE schemaname = 'public';
+    EXECUTE 'TRUNCATE ' || tables || ' CASCADE';
+END $$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testMailer keeps the messages sent during a test.
+type testMailer struct {
+	sent chan mailer.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sent <- msg
+	return nil
+}
+
+// next waits for the next message sent in the background.
+func (m *testMailer) next(t *testing.T) mailer.Message {
+	t.Helper()
+
+	select {
+	case msg := <-m.sent:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail was sent")
+		return mailer.Message{}
+	}
+}
+
+// link returns the first line of msg that starts with the base url.
+func (m *testMailer) link(t *testing.T) string {
+	t.Helper()
+
+	msg := m.next(t)
+	for _, line := range strings.Split(msg.Body, "\n") {
+		if strings.HasPrefix(line, testBaseURL) {
+			return strings.TrimSpace(line)
+		}
+	}
+	t.Fatalf("no link in mail %q", msg.Body)
+	return ""
+}
+
+// newTestConfig returns an apiConfig on an empty test database, with cheap
+// password hashing and a mailer that records what it sends.
+func newTestConfig(t *testing.T) (*apiConfig, *testMailer) {
+	t.Helper()
+
+	db := openTestDB(t)
+	truncateTestDB(t, db)
+
+	cfg := newTestConfigWithoutDB(t)
+	cfg.db = db
+	cfg.sql = database.New(db)
+	cfg.denylist = auth.NewDenylist(denylistStore{sql: cfg.sql})
+
+	mail := &testMailer{sent: make(chan mailer.Message, 16)}
+	cfg.mailer = mail
+	return cfg, mail
+}
+
+// newTestConfigWithoutDB returns an apiConfig for the handlers and checks
+// that never reach the database.
+func newTestConfigWithoutDB(t *testing.T) *apiConfig {
+	t.Helper()
+
+	keys, err := auth.NewKeyring(auth.NewHMACKey("test", []byte("test-secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	relyingParty, err := webauthn.NewRelyingParty("Chirpy", testBaseURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &apiConfig{
+		platform:      "dev",
+		secret:        "test-secret",
+		keys:          keys,
+		jwtOptions:    auth.AccessTokenOptions(keys),
+		challengeOpts: auth.ChallengeTokenOptions(keys),
+		denylist:      auth.NewDenylist(memoryDenylistStore{}),
+		dpopReplay:    auth.NewReplayCache(),
+		polkaKey:      "test-polka-key",
+		baseURL:       testBaseURL,
+		mailer:        mailer.NewWriterMailer(&bytes.Buffer{}, "test@chirpy.test"),
+		passwords: auth.PasswordHasher{Params: auth.Argon2Params{
+			Memory:      64,
+			Iterations:  1,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		}},
+		loginPolicy:   throttle.DefaultPolicy,
+		deletionGrace: 30 * 24 * time.Hour,
+		relyingParty:  relyingParty,
+	}
+}
+
+// memoryDenylistStore stands in for the database behind the denylist.
+type memoryDenylistStore struct{}
+
+func (memoryDenylistStore) AddRevokedToken(ctx context.Context, jti string, userID uuid.UUID, expiresAt time.Time) error {
+	return nil
+}
+
+func (memoryDenylistStore) RevokedTokensSince(ctx context.Context, since time.Time) ([]auth.RevokedToken, error) {
+	return nil, nil
+}
+
+func (memoryDenylistStore) PruneRevokedTokens(ctx context.Context, before time.Time) error {
+	return nil
+}
+
+// createTestUser stores a user with testPassword.
+func createTestUser(t *testing.T, cfg *apiConfig, email string) database.User {
+	t.Helper()
+
+	hashedPassword, err := cfg.passwords.Hash(testPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := cfg.sql.CreateUser(context.Background(), database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// sessionTokens are the tokens returned by a login.
+type sessionTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// loginTestUser logs in with testPassword and returns the session tokens.
+func loginTestUser(t *testing.T, cfg *apiConfig, email string) sessionTokens {
+	t.Helper()
+
+	rr := serve(cfg.createSession, newJSONRequest(http.MethodPost, "/api/login", map[string]any{
+		"email":    email,
+		"password": testPassword,
+	}))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login: status %d, body %s", rr.Code, rr.Body)
+	}
+	return decodeBody[sessionTokens](t, rr)
+}
+
+// newJSONRequest returns a request with body encoded as JSON.
+func newJSONRequest(method, target string, body any) *http.Request {
+	var buf bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&buf).Encode(body)
+		if err != nil {
+			panic(err)
+		}
+	}
+	r := httptest.NewRequest(method, target, &buf)
+	r.Header.Set("Content-Type", "application/json")
+	return r
+}
+
+// withBearer authenticates r with token.
+func withBearer(r *http.Request, token string) *http.Request {
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+// serve runs handler on r and returns the recorded response.
+func serve(handler http.HandlerFunc, r *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	handler(rr, r)
+	return rr
+}
+
+// decodeBody decodes the JSON response body into a T.
+func decodeBody[T any](t *testing.T, rr *httptest.ResponseRecorder) T {
+	t.Helper()
+
+	var v T
+	err := json.Unmarshal(rr.Body.Bytes(), &v)
+	if err != nil {
+		t.Fatalf("decoding %q: %s", rr.Body, err)
+	}
+	return v
+}
+
+// createTestPAT creates a personal access token with scopes using the
+// session access token.
+func createTestPAT(t *testing.T, cfg *apiConfig, accessToken string, scopes ...string) string {
+	t.Helper()
+
+	rr := serve(cfg.createPersonalAccessToken, withBearer(newJSONRequest(http.MethodPost, "/api/tokens", map[string]any{
+		"name":   "test",
+		"scopes": scopes,
+	}), accessToken))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("creating personal access token: status %d, body %s", rr.Code, rr.Body)
+	}
+
+	type response struct {
+		Token string `json:"token"`
+	}
+	return decodeBody[response](t, rr).Token
+}
+
+// tokenQuery returns the token query parameter of link.
+func tokenQuery(t *testing.T, link string) string {
+	t.Helper()
+
+	u, err := url.Parse(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := u.Query().Get("token")
+	if token == "" {
+		t.Fatalf("no token in %q", link)
+	}
+	return token
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	oauthCodeDuration        = 5 * time.Minute
+	oauthAccessTokenDuration = 1 * time.Hour
+)
+
+// oauthError is an error reported to OAuth clients with one of the error
+// codes of RFC 6749.
+type oauthError struct {
+	Code        string
+	Description string
+}
+
+func (e *oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// authorizationRequest is a validated request to /oauth/authorize.
+type authorizationRequest struct {
+	Client        database.OauthClient
+	RedirectURI   string
+	State         string
+	Scopes        []string
+	CodeChallenge string
+}
+
+// parseAuthorizationRequest validates the parameters of an authorization
+// request. As long as the client and redirect URI are unknown the returned
+// request has no RedirectURI and errors must be shown to the user; after
+// that they are reported back to the client through the redirect URI.
+func (cfg *apiConfig) parseAuthorizationRequest(r *http.Request) (authorizationRequest, error) {
+	var req authorizationRequest
+
+	clientID, err := uuid.Parse(r.FormValue("client_id"))
+	if err != nil {
+		return req, &oauthError{"invalid_request", "Unknown client"}
+	}
+
+	req.Client, err = cfg.sql.GetOAuthClientByID(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return req, &oauthError{"invalid_request", "Unknown client"}
+	}
+	if err != nil {
+		return req, err
+	}
+
+	redirectURI := r.FormValue("redirect_uri")
+	if redirectURI == "" && len(req.Client.RedirectUris) == 1 {
+		redirectURI = req.Client.RedirectUris[0]
+	}
+	if !slices.Contains(req.Client.RedirectUris, redirectURI) {
+		return req, &oauthError{"invalid_request", "Redirect URI is not registered for this client"}
+	}
+
+	req.RedirectURI = redirectURI
+	req.State = r.FormValue("state")
+
+	if r.FormValue("response_type") != "code" {
+		return req, &oauthError{"unsupported_response_type", "Only the code response type is supported"}
+	}
+
+	req.Scopes = auth.ParseScope(r.FormValue("scope"))
+	if len(req.Scopes) == 0 {
+		req.Scopes = req.Client.Scopes
+	}
+	if !containsAll(req.Client.Scopes, req.Scopes) {
+		return req, &oauthError{"invalid_scope", "The client may not request these scopes"}
+	}
+
+	// PKCE is required for every client, confidential or not.
+	req.CodeChallenge = r.FormValue("code_challenge")
+	if req.CodeChallenge == "" || r.FormValue("code_challenge_method") != "S256" {
+		return req, &oauthError{"invalid_request", "A code_challenge with the S256 method is required"}
+	}
+
+	return req, nil
+}
+
+// authorizationRedirect returns the redirect URI of req with params and the
+// state of the request added to its query.
+func authorizationRedirect(req authorizationRequest, params url.Values) string {
+	u, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		return req.RedirectURI
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// errorRedirect returns the redirect URI of req reporting err to the client.
+func errorRedirect(req authorizationRequest, err error) string {
+	var oauthErr *oauthError
+	if !errors.As(err, &oauthErr) {
+		oauthErr = &oauthError{"server_error", "Something went wrong"}
+	}
+	return authorizationRedirect(req, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+	})
+}
+
+// authorizeOAuth is where clients send the user's browser. A valid request
+// is passed on to the consent page at /app/authorize/, which fetches what to
+// show the user from here as JSON and then calls approveOAuth with their
+// decision.
+func (cfg *apiConfig) authorizeOAuth(w http.ResponseWriter, r *http.Request) {
+	wantsJSON := strings.Contains(r.Header.Get("Accept"), "application/json")
+
+	req, err := cfg.parseAuthorizationRequest(r)
+	if err != nil && req.RedirectURI == "" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		writeErrorJson(w, err, "Invalid authorization request")
+		return
+	}
+
+	if err != nil {
+		log.Printf("Error: %s", err)
+		if wantsJSON {
+			type response struct {
+				RedirectTo string `json:"redirect_to"`
+			}
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			writeSuccessJson(w, response{errorRedirect(req, err)})
+			return
+		}
+		http.Redirect(w, r, errorRedirect(req, err), http.StatusFound)
+		return
+	}
+
+	if wantsJSON {
+		type response struct {
+			ClientID    uuid.UUID `json:"client_id"`
+			ClientName  string    `json:"client_name"`
+			RedirectURI string    `json:"redirect_uri"`
+			Scopes      []string  `json:"scopes"`
+		}
+		resp := response{req.Client.ID, req.Client.Name, req.RedirectURI, req.Scopes}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		writeSuccessJson(w, resp)
+		return
+	}
+
+	http.Redirect(w, r, cfg.baseURL+"/app/authorize/?"+r.URL.RawQuery, http.StatusFound)
+}
+
+// approveOAuth records the decision of the logged in user on an
+// authorization request and tells the consent page where to send the
+// browser next. The parameters are those of the original request plus
+// approved=true if the user agreed.
+func (cfg *apiConfig) approveOAuth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	type response struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+
+	req, err := cfg.parseAuthorizationRequest(r)
+	if err != nil && req.RedirectURI == "" {
+		writeErrorJson(w, err, "Invalid authorization request")
+		return
+	}
+	if err != nil {
+		log.Printf("Error: %s", err)
+		writeSuccessJson(w, response{errorRedirect(req, err)})
+		return
+	}
+
+	if r.FormValue("approved") != "true" {
+		err = &oauthError{"access_denied", "The user denied the request"}
+		writeSuccessJson(w, response{errorRedirect(req, err)})
+		return
+	}
+
+	code, err := auth.MakeRefreshToken()
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	err = cfg.sql.CreateOAuthAuthorizationCode(r.Context(), database.CreateOAuthAuthorizationCodeParams{
+		CodeHash:      auth.HashToken(code),
+		ClientID:      req.Client.ID,
+		UserID:        caller.UserID,
+		RedirectUri:   req.RedirectURI,
+		Scopes:        req.Scopes,
+		CodeChallenge: req.CodeChallenge,
+		FamilyID:      uuid.New(),
+		ExpiresAt:     time.Now().Add(oauthCodeDuration),
+	})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	writeSuccessJson(w, response{authorizationRedirect(req, url.Values{"code": {code}})})
+}
+
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+}
+
+// oauthToken is the token endpoint of RFC 6749. It takes form encoded
+// parameters and supports the authorization_code and refresh_token grants.
+func (cfg *apiConfig) oauthToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	err := r.ParseForm()
+	if err != nil {
+		writeOAuthError(w, &oauthError{"invalid_request", "Malformed request body"})
+		return
+	}
+
+	client, err := cfg.authenticateOAuthClient(r)
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	var resp oauthTokenResponse
+	switch r.PostFormValue("grant_type") {
+	case "authorization_code":
+		resp, err = cfg.exchangeAuthorizationCode(r, client)
+	case "refresh_token":
+		resp, err = cfg.refreshOAuthToken(r, client)
+	default:
+		err = &oauthError{"unsupported_grant_type", "Unsupported grant type"}
+	}
+	if err != nil {
+		writeOAuthError(w, err)
+		return
+	}
+
+	writeSuccessJson(w, resp)
+}
+
+// authenticateOAuthClient identifies the client calling the token endpoint
+// by HTTP basic auth or the client_id and client_secret parameters. Public
+// clients send no secret.
+func (cfg *apiConfig) authenticateOAuthClient(r *http.Request) (database.OauthClient, error) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+
+	clientID, err := uuid.Parse(id)
+	if err != nil {
+		return database.OauthClient{}, &oauthError{"invalid_client", "Unknown client"}
+	}
+
+	client, err := cfg.sql.GetOAuthClientByID(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.OauthClient{}, &oauthError{"invalid_client", "Unknown client"}
+	}
+	if err != nil {
+		return database.OauthClient{}, err
+	}
+
+	if client.SecretHash.Valid && subtle.ConstantTimeCompare([]byte(auth.HashToken(secret)), []byte(client.SecretHash.String)) != 1 {
+		return database.OauthClient{}, &oauthError{"invalid_client", "Invalid client secret"}
+	}
+
+	return client, nil
+}
+
+func (cfg *apiConfig) exchangeAuthorizationCode(r *http.Request, client database.OauthClient) (oauthTokenResponse, error) {
+	codeHash := auth.HashToken(r.PostFormValue("code"))
+
+	code, err := cfg.sql.ConsumeOAuthAuthorizationCode(r.Context(), codeHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		// A code that comes back after it was redeemed may have been
+		// intercepted, so the tokens issued for it are revoked as well.
+		used, err := cfg.sql.GetOAuthAuthorizationCode(r.Context(), codeHash)
+		if err == nil && used.ClientID == client.ID {
+			cfg.revokeRefreshTokenFamily(r, used.UserID, used.FamilyID)
+		}
+		return oauthTokenResponse{}, &oauthError{"invalid_grant", "Invalid authorization code"}
+	}
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+
+	if code.ClientID != client.ID || code.ExpiresAt.Before(time.Now()) {
+		return oauthTokenResponse{}, &oauthError{"invalid_grant", "Invalid authorization code"}
+	}
+	if code.RedirectUri != r.PostFormValue("redirect_uri") {
+		return oauthTokenResponse{}, &oauthError{"invalid_grant", "Redirect URI does not match the authorization request"}
+	}
+	if !auth.VerifyPKCE(r.PostFormValue("code_verifier"), code.CodeChallenge) {
+		return oauthTokenResponse{}, &oauthError{"invalid_grant", "Invalid code verifier"}
+	}
+
+	refreshToken, err := issueRefreshToken(r.Context(), cfg.sql, database.CreateRefreshTokenParams{
+		UserID:    code.UserID,
+		FamilyID:  code.FamilyID,
+		ClientID:  uuid.NullUUID{UUID: client.ID, Valid: true},
+		Scopes:    code.Scopes,
+		UserAgent: userAgent(r),
+		IpAddress: cfg.clientIP(r),
+	})
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+
+	return cfg.makeOAuthTokenResponse(code.UserID, client.ID, code.FamilyID, code.Scopes, refreshToken)
+}
+
+func (cfg *apiConfig) refreshOAuthToken(r *http.Request, client database.OauthClient) (oauthTokenResponse, error) {
+	refreshToken, err := cfg.sql.GetRefreshTokenByHashIncludingRevoked(r.Context(), auth.HashToken(r.PostFormValue("refresh_token")))
+	if errors.Is(err, sql.ErrNoRows) {
+		return oauthTokenResponse{}, &oauthError{"invalid_grant", "Invalid refresh token"}
+	}
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+
+	if !refreshToken.ClientID.Valid || refreshToken.ClientID.UUID != client.ID {
+		return oauthTokenResponse{}, &oauthError{"invalid_grant", "Invalid refresh token"}
+	}
+	if refreshToken.RevokedAt.Valid {
+		cfg.revokeRefreshTokenFamily(r, refreshToken.UserID, refreshToken.FamilyID)
+		return oauthTokenResponse{}, &oauthError{"invalid_grant", "Invalid refresh token"}
+	}
+	if refreshToken.ExpiresAt.Before(time.Now()) {
+		return oauthTokenResponse{}, &oauthError{"invalid_grant", "Refresh token expired"}
+	}
+
+	// The client may ask for an access token with fewer scopes; the new
+	// refresh token keeps the full grant.
+	scopes := refreshToken.Scopes
+	if requested := auth.ParseScope(r.PostFormValue("scope")); len(requested) > 0 {
+		if !containsAll(refreshToken.Scopes, requested) {
+			return oauthTokenResponse{}, &oauthError{"invalid_scope", "Scopes exceed the original grant"}
+		}
+		scopes = requested
+	}
+
+	newToken, err := cfg.rotateRefreshToken(r, refreshToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.revokeRefreshTokenFamily(r, refreshToken.UserID, refreshToken.FamilyID)
+		return oauthTokenResponse{}, &oauthError{"invalid_grant", "Invalid refresh token"}
+	}
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+
+	return cfg.makeOAuthTokenResponse(refreshToken.UserID, client.ID, refreshToken.FamilyID, scopes, newToken)
+}
+
+func (cfg *apiConfig) makeOAuthTokenResponse(userID, clientID, familyID uuid.UUID, scopes []string, refreshToken string) (oauthTokenResponse, error) {
+	accessToken, err := auth.MakeDelegatedJWT(userID, clientID, familyID, scopes, cfg.keys, oauthAccessTokenDuration)
+	if err != nil {
+		return oauthTokenResponse{}, err
+	}
+
+	return oauthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(oauthAccessTokenDuration.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+// writeOAuthError responds with the error format of RFC 6749 section 5.2.
+// Errors other than an oauthError are reported as server_error.
+func writeOAuthError(w http.ResponseWriter, err error) {
+	log.Printf("Error: %s", err)
+
+	var oauthErr *oauthError
+	if !errors.As(err, &oauthErr) {
+		oauthErr = &oauthError{"server_error", "Something went wrong"}
+	}
+
+	type response struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	resp := response{oauthErr.Code, oauthErr.Description}
+
+	switch oauthErr.Code {
+	case "invalid_client":
+		w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	case "server_error":
+		w.WriteHeader(http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// pruneOAuthAuthorizationCodes deletes authorization codes that expired a
+// day ago, keeping recent ones around to detect their reuse.
+func (cfg *apiConfig) pruneOAuthAuthorizationCodes(ctx context.Context) error {
+	return cfg.sql.DeleteExpiredOAuthAuthorizationCodes(ctx, time.Now().Add(-24*time.Hour))
+}
+
+// containsAll reports whether every entry of subset is in set.
+func containsAll(set, subset []string) bool {
+	for _, s := range subset {
+		if !slices.Contains(set, s) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type oauthClientResponse struct {
+	ID           uuid.UUID `json:"client_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Confidential bool      `json:"confidential"`
+	Secret       string    `json:"client_secret,omitempty"`
+}
+
+func newOAuthClientResponse(client database.OauthClient) oauthClientResponse {
+	return oauthClientResponse{
+		ID:           client.ID,
+		CreatedAt:    client.CreatedAt,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectUris,
+		Scopes:       client.Scopes,
+		Confidential: client.SecretHash.Valid,
+	}
+}
+
+func (cfg *apiConfig) createOAuthClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Name         string   `json:"name"`
+		RedirectURIs []string `json:"redirect_uris"`
+		Scopes       []string `json:"scopes"`
+		// Confidential clients can keep a secret, e.g. server side apps.
+		// Public clients such as mobile apps rely on PKCE alone.
+		Confidential bool `json:"confidential"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > 100 {
+		writeErrorJson(w, errors.New("invalid client name"), "Name must be between 1 and 100 characters")
+		return
+	}
+
+	if len(params.RedirectURIs) == 0 {
+		writeErrorJson(w, errors.New("no redirect uris"), "At least one redirect URI is required")
+		return
+	}
+	for _, uri := range params.RedirectURIs {
+		if !validRedirectURI(uri) {
+			writeErrorJson(w, errors.New("invalid redirect uri"), "Invalid redirect URI "+uri)
+			return
+		}
+	}
+
+	if len(params.Scopes) == 0 || !auth.ValidScopes(params.Scopes) {
+		writeErrorJson(w, errors.New("invalid scopes"), "Scopes must be one or more of: "+strings.Join(auth.Scopes, ", "))
+		return
+	}
+
+	var secret string
+	var secretHash sql.NullString
+	if params.Confidential {
+		secret, err = auth.MakeRefreshToken()
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+		secretHash = sql.NullString{String: auth.HashToken(secret), Valid: true}
+	}
+
+	client, err := cfg.sql.CreateOAuthClient(r.Context(), database.CreateOAuthClientParams{
+		UserID:       caller.UserID,
+		Name:         name,
+		SecretHash:   secretHash,
+		RedirectUris: params.RedirectURIs,
+		Scopes:       params.Scopes,
+	})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	// The secret itself is only ever shown in this response.
+	resp := newOAuthClientResponse(client)
+	resp.Secret = secret
+
+	writeSuccessJson(w, resp, http.StatusCreated)
+}
+
+func (cfg *apiConfig) indexOAuthClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	clients, err := cfg.sql.GetOAuthClientsByUserID(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	resp := []oauthClientResponse{}
+	for _, client := range clients {
+		resp = append(resp, newOAuthClientResponse(client))
+	}
+
+	writeSuccessJson(w, resp)
+}
+
+// showOAuthClient returns the public details of a client, which the consent
+// page shows to the user being asked to authorize it.
+func (cfg *apiConfig) showOAuthClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	client, err := cfg.sql.GetOAuthClientByID(r.Context(), clientID)
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	writeSuccessJson(w, newOAuthClientResponse(client))
+}
+
+// deleteOAuthClient removes a client along with its authorization codes and
+// refresh tokens. Access tokens already issued run out within the hour.
+func (cfg *apiConfig) deleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	clientID, err := uuid.Parse(r.PathValue("clientID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	rows, err := cfg.sql.DeleteOAuthClient(r.Context(), database.DeleteOAuthClientParams{
+		ID:     clientID,
+		UserID: caller.UserID,
+	})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if rows == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, errors.New("client not found"), "Something went wrong")
+		return
+	}
+
+	writeSuccessJson(w, nil, http.StatusNoContent)
+}
+
+// validRedirectURI accepts absolute https URLs without a fragment. Plain
+// http is only allowed for loopback addresses, for apps running locally.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Host == "" || u.Fragment != "" {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	default:
+		return false
+	}
+}
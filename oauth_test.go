@@ -0,0 +1,223 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	testRedirectURI      = "https://app.example/callback"
+	testOtherRedirectURI = "https://app.example/other"
+	testCodeVerifier     = "a-code-verifier-that-is-long-enough-for-pkce-0123456789"
+)
+
+// oauthTest is a public client of a logged in user.
+type oauthTest struct {
+	cfg      *apiConfig
+	session  sessionTokens
+	clientID string
+}
+
+func newOAuthTest(t *testing.T) oauthTest {
+	t.Helper()
+
+	cfg, _ := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+
+	rr := serve(cfg.createOAuthClient, withBearer(newJSONRequest(http.MethodPost, "/api/oauth/clients", map[string]any{
+		"name":          "Chirp Scheduler",
+		"redirect_uris": []string{testRedirectURI, testOtherRedirectURI},
+		"scopes":        []string{auth.ScopeChirpsRead, auth.ScopeChirpsWrite},
+	}), session.Token))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("creating client: status %d, body %s", rr.Code, rr.Body)
+	}
+
+	type response struct {
+		ClientID string `json:"client_id"`
+	}
+	return oauthTest{cfg, session, decodeBody[response](t, rr).ClientID}
+}
+
+// authorizationQuery is the query of an authorization request for scope.
+func (o oauthTest) authorizationQuery(scope string) string {
+	return url.Values{
+		"client_id":             {o.clientID},
+		"redirect_uri":          {testRedirectURI},
+		"response_type":         {"code"},
+		"scope":                 {scope},
+		"state":                 {"xyz"},
+		"code_challenge":        {auth.PKCEChallenge(testCodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+}
+
+// code has the user approve an authorization request for scope and returns
+// the authorization code.
+func (o oauthTest) code(t *testing.T, scope string) string {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodPost, "/oauth/authorize?"+o.authorizationQuery(scope), strings.NewReader("approved=true"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rr := serve(o.cfg.approveOAuth, withBearer(r, o.session.Token))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("approving: status %d, body %s", rr.Code, rr.Body)
+	}
+
+	type response struct {
+		RedirectTo string `json:"redirect_to"`
+	}
+	redirect, err := url.Parse(decodeBody[response](t, rr).RedirectTo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirect.Query().Get("state") != "xyz" {
+		t.Errorf("redirect %s lost the state", redirect)
+	}
+	return redirect.Query().Get("code")
+}
+
+// token calls the token endpoint with form.
+func (o oauthTest) token(form url.Values) *httptest.ResponseRecorder {
+	form.Set("client_id", o.clientID)
+	r := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return serve(o.cfg.oauthToken, r)
+}
+
+// exchange redeems code with the given redirect URI and code verifier.
+func (o oauthTest) exchange(code, redirectURI, verifier string) *httptest.ResponseRecorder {
+	return o.token(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"code_verifier": {verifier},
+	})
+}
+
+func TestAuthorizeOAuthShowsConsent(t *testing.T) {
+	o := newOAuthTest(t)
+	query := o.authorizationQuery(auth.ScopeChirpsRead)
+
+	rr := serve(o.cfg.authorizeOAuth, httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+query, nil))
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != testBaseURL+"/app/authorize/?"+query {
+		t.Fatalf("browser request: status %d, location %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// The consent page is served where the browser is sent.
+	page := httptest.NewRecorder()
+	http.StripPrefix("/app", http.FileServer(http.Dir("."))).ServeHTTP(page, httptest.NewRequest(http.MethodGet, "/app/authorize/?"+query, nil))
+	if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), "/oauth/authorize") {
+		t.Fatalf("consent page: status %d", page.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+query, nil)
+	r.Header.Set("Accept", "application/json")
+	rr = serve(o.cfg.authorizeOAuth, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("consent details: status %d, body %s", rr.Code, rr.Body)
+	}
+
+	type response struct {
+		ClientName  string   `json:"client_name"`
+		RedirectURI string   `json:"redirect_uri"`
+		Scopes      []string `json:"scopes"`
+	}
+	consent := decodeBody[response](t, rr)
+	if consent.ClientName != "Chirp Scheduler" || consent.RedirectURI != testRedirectURI || !slices.Equal(consent.Scopes, []string{auth.ScopeChirpsRead}) {
+		t.Errorf("consent = %+v", consent)
+	}
+}
+
+func TestOAuthCodeExchange(t *testing.T) {
+	o := newOAuthTest(t)
+
+	tests := []struct {
+		name        string
+		redirectURI string
+		verifier    string
+		want        int
+	}{
+		{"pkce mismatch", testRedirectURI, strings.Repeat("x", 50), http.StatusBadRequest},
+		{"missing verifier", testRedirectURI, "", http.StatusBadRequest},
+		{"other registered redirect uri", testOtherRedirectURI, testCodeVerifier, http.StatusBadRequest},
+		{"valid", testRedirectURI, testCodeVerifier, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := o.exchange(o.code(t, auth.ScopeChirpsRead), tt.redirectURI, tt.verifier)
+			if rr.Code != tt.want {
+				t.Errorf("status %d, want %d, body %s", rr.Code, tt.want, rr.Body)
+			}
+		})
+	}
+}
+
+func TestOAuthCodeReuseRevokesTokens(t *testing.T) {
+	o := newOAuthTest(t)
+	code := o.code(t, auth.ScopeChirpsRead)
+
+	rr := o.exchange(code, testRedirectURI, testCodeVerifier)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("exchange: status %d, body %s", rr.Code, rr.Body)
+	}
+	tokens := decodeBody[oauthTokenResponse](t, rr)
+
+	rr = o.exchange(code, testRedirectURI, testCodeVerifier)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("reused code: status %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+
+	// Whoever redeemed the code first may have intercepted it.
+	rr = o.token(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("refresh token issued for the reused code: status %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+	_, err := o.cfg.authenticate(withBearer(httptest.NewRequest(http.MethodGet, "/api/chirps", nil), tokens.AccessToken))
+	if err == nil {
+		t.Error("access token issued for the reused code still authenticates")
+	}
+}
+
+func TestOAuthRefreshKeepsGrantedScopes(t *testing.T) {
+	o := newOAuthTest(t)
+	granted := auth.ScopeChirpsRead + " " + auth.ScopeChirpsWrite
+
+	rr := o.exchange(o.code(t, granted), testRedirectURI, testCodeVerifier)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("exchange: status %d, body %s", rr.Code, rr.Body)
+	}
+	tokens := decodeBody[oauthTokenResponse](t, rr)
+
+	// A narrower access token doesn't narrow the grant.
+	rr = o.token(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {tokens.RefreshToken}, "scope": {auth.ScopeChirpsRead}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("narrow refresh: status %d, body %s", rr.Code, rr.Body)
+	}
+	narrow := decodeBody[oauthTokenResponse](t, rr)
+	if narrow.Scope != auth.ScopeChirpsRead {
+		t.Errorf("narrow refresh scope = %q, want %q", narrow.Scope, auth.ScopeChirpsRead)
+	}
+
+	rr = o.token(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {narrow.RefreshToken}})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("full refresh: status %d, body %s", rr.Code, rr.Body)
+	}
+	full := decodeBody[oauthTokenResponse](t, rr)
+	if full.Scope != granted {
+		t.Errorf("full refresh scope = %q, want %q", full.Scope, granted)
+	}
+
+	// Scopes beyond the grant are refused.
+	rr = o.token(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {full.RefreshToken}, "scope": {auth.ScopeProfileWrite}})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("wider refresh: status %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
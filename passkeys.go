@@ -0,0 +1,512 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/webauthn"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Passkeys are registered and used through the WebAuthn ceremonies: the
+// begin endpoints hand out a single use challenge along with the options
+// for navigator.credentials, the finish endpoints verify what the
+// authenticator signed.
+const (
+	passkeyRegistration = "registration"
+	passkeyLogin        = "login"
+
+	passkeyChallengeDuration = 5 * time.Minute
+	maxPasskeyNameLength     = 100
+)
+
+// base64URL is binary data that travels as unpadded base64url, like the
+// fields of PublicKeyCredential.toJSON().
+type base64URL []byte
+
+func (b base64URL) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+func (b *base64URL) UnmarshalJSON(data []byte) error {
+	var s string
+	err := json.Unmarshal(data, &s)
+	if err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+type passkeyDescriptor struct {
+	Type string    `json:"type"`
+	ID   base64URL `json:"id"`
+}
+
+type passkeyResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func newPasskeyResponse(credential database.WebauthnCredential) passkeyResponse {
+	resp := passkeyResponse{
+		ID:        credential.ID,
+		CreatedAt: credential.CreatedAt,
+		Name:      credential.Name,
+	}
+	if credential.LastUsedAt.Valid {
+		resp.LastUsedAt = &credential.LastUsedAt.Time
+	}
+	return resp
+}
+
+func passkeyDescriptors(credentials []database.WebauthnCredential) []passkeyDescriptor {
+	descriptors := []passkeyDescriptor{}
+	for _, credential := range credentials {
+		descriptors = append(descriptors, passkeyDescriptor{"public-key", credential.CredentialID})
+	}
+	return descriptors
+}
+
+func passkeyThrottleKey(ip string) string {
+	return "passkey-ip:" + ip
+}
+
+// createPasskeyChallenge stores a fresh challenge for ceremony.
+func (cfg *apiConfig) createPasskeyChallenge(ctx context.Context, userID uuid.NullUUID, ceremony string) (database.WebauthnChallenge, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return database.WebauthnChallenge{}, err
+	}
+
+	return cfg.sql.CreateWebAuthnChallenge(ctx, database.CreateWebAuthnChallengeParams{
+		UserID:    userID,
+		Ceremony:  ceremony,
+		Challenge: challenge,
+		ExpiresAt: time.Now().Add(passkeyChallengeDuration),
+	})
+}
+
+// beginPasskeyRegistration returns the options for registering a new
+// passkey for the caller. A passkey outlives the session it was added from,
+// so the password is asked for again; accounts without one set it first
+// through the password reset flow.
+func (cfg *apiConfig) beginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Password string `json:"password"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	user, err := cfg.sql.GetUserByID(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+
+	if !cfg.confirmPassword(w, r, user, params.Password) {
+		return
+	}
+
+	credentials, err := cfg.sql.GetWebAuthnCredentialsByUserID(r.Context(), user.ID)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	challenge, err := cfg.createPasskeyChallenge(r.Context(), uuid.NullUUID{UUID: user.ID, Valid: true}, passkeyRegistration)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	type relyingParty struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	type userEntity struct {
+		ID          base64URL `json:"id"`
+		Name        string    `json:"name"`
+		DisplayName string    `json:"displayName"`
+	}
+	type credentialParameter struct {
+		Type string `json:"type"`
+		Alg  int64  `json:"alg"`
+	}
+	type authenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	}
+	type publicKeyOptions struct {
+		Challenge              base64URL              `json:"challenge"`
+		RP                     relyingParty           `json:"rp"`
+		User                   userEntity             `json:"user"`
+		PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+		Timeout                int64                  `json:"timeout"`
+		ExcludeCredentials     []passkeyDescriptor    `json:"excludeCredentials"`
+		AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+		Attestation            string                 `json:"attestation"`
+	}
+	type response struct {
+		ChallengeID uuid.UUID        `json:"challenge_id"`
+		PublicKey   publicKeyOptions `json:"publicKey"`
+	}
+
+	credentialParams := []credentialParameter{}
+	for _, alg := range webauthn.Algorithms {
+		credentialParams = append(credentialParams, credentialParameter{"public-key", alg})
+	}
+
+	resp := response{
+		ChallengeID: challenge.ID,
+		PublicKey: publicKeyOptions{
+			Challenge:              challenge.Challenge,
+			RP:                     relyingParty{cfg.relyingParty.ID, cfg.relyingParty.Name},
+			User:                   userEntity{user.ID[:], user.Email, user.Email},
+			PubKeyCredParams:       credentialParams,
+			Timeout:                passkeyChallengeDuration.Milliseconds(),
+			ExcludeCredentials:     passkeyDescriptors(credentials),
+			AuthenticatorSelection: authenticatorSelection{"preferred", "required"},
+			Attestation:            "none",
+		},
+	}
+
+	writeSuccessJson(w, resp)
+}
+
+func (cfg *apiConfig) finishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		ChallengeID uuid.UUID `json:"challenge_id"`
+		Name        string    `json:"name"`
+		Credential  struct {
+			Response struct {
+				ClientDataJSON    base64URL `json:"clientDataJSON"`
+				AttestationObject base64URL `json:"attestationObject"`
+			} `json:"response"`
+		} `json:"credential"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len(name) > maxPasskeyNameLength {
+		writeErrorJson(w, errors.New("passkey name too long"), "Name is too long")
+		return
+	}
+
+	challenge, err := cfg.sql.ConsumeWebAuthnChallenge(r.Context(), database.ConsumeWebAuthnChallengeParams{
+		ID:       params.ChallengeID,
+		Ceremony: passkeyRegistration,
+	})
+	if err != nil || challenge.UserID.UUID != caller.UserID {
+		writeErrorJson(w, errors.New("registration challenge invalid or expired"), "Registration expired, please try again")
+		return
+	}
+
+	response := params.Credential.Response
+	credential, err := cfg.relyingParty.VerifyRegistration(challenge.Challenge, response.ClientDataJSON, response.AttestationObject, true)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't verify passkey")
+		return
+	}
+
+	_, err = cfg.sql.GetWebAuthnCredentialByCredentialID(r.Context(), credential.ID)
+	if err == nil {
+		w.WriteHeader(http.StatusConflict)
+		writeErrorJson(w, errors.New("passkey already registered"), "Passkey is already registered")
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	stored, err := cfg.sql.CreateWebAuthnCredential(r.Context(), database.CreateWebAuthnCredentialParams{
+		UserID:       caller.UserID,
+		CredentialID: credential.ID,
+		PublicKey:    credential.PublicKey,
+		SignCount:    int64(credential.SignCount),
+		Name:         name,
+	})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	writeSuccessJson(w, newPasskeyResponse(stored), http.StatusCreated)
+}
+
+func (cfg *apiConfig) indexPasskeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	credentials, err := cfg.sql.GetWebAuthnCredentialsByUserID(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	resp := []passkeyResponse{}
+	for _, credential := range credentials {
+		resp = append(resp, newPasskeyResponse(credential))
+	}
+
+	writeSuccessJson(w, resp)
+}
+
+func (cfg *apiConfig) deletePasskey(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	credentialID, err := uuid.Parse(r.PathValue("credentialID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	rows, err := cfg.sql.DeleteWebAuthnCredential(r.Context(), database.DeleteWebAuthnCredentialParams{
+		ID:     credentialID,
+		UserID: caller.UserID,
+	})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if rows == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, errors.New("passkey not found"), "Something went wrong")
+		return
+	}
+
+	writeSuccessJson(w, nil, http.StatusNoContent)
+}
+
+// beginPasskeyLogin returns the options for logging in with a passkey.
+// Without an email any discoverable passkey for the site can be used; with
+// one the browser is pointed at that account's passkeys. Unknown emails get
+// the same answer as accounts without passkeys.
+func (cfg *apiConfig) beginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	var params parameters
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	var userID uuid.NullUUID
+	allowCredentials := []passkeyDescriptor{}
+	if email := strings.TrimSpace(params.Email); email != "" {
+		user, err := cfg.sql.GetUserByEmail(r.Context(), email)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+		if err == nil {
+			credentials, err := cfg.sql.GetWebAuthnCredentialsByUserID(r.Context(), user.ID)
+			if err != nil {
+				writeErrorJson(w, err, "Something went wrong")
+				return
+			}
+			userID = uuid.NullUUID{UUID: user.ID, Valid: true}
+			allowCredentials = passkeyDescriptors(credentials)
+		}
+	}
+
+	challenge, err := cfg.createPasskeyChallenge(r.Context(), userID, passkeyLogin)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	type publicKeyOptions struct {
+		Challenge        base64URL           `json:"challenge"`
+		RPID             string              `json:"rpId"`
+		Timeout          int64               `json:"timeout"`
+		AllowCredentials []passkeyDescriptor `json:"allowCredentials"`
+		UserVerification string              `json:"userVerification"`
+	}
+	type response struct {
+		ChallengeID uuid.UUID        `json:"challenge_id"`
+		PublicKey   publicKeyOptions `json:"publicKey"`
+	}
+	resp := response{
+		ChallengeID: challenge.ID,
+		PublicKey: publicKeyOptions{
+			Challenge:        challenge.Challenge,
+			RPID:             cfg.relyingParty.ID,
+			Timeout:          passkeyChallengeDuration.Milliseconds(),
+			AllowCredentials: allowCredentials,
+			UserVerification: "required",
+		},
+	}
+
+	writeSuccessJson(w, resp)
+}
+
+// finishPasskeyLogin verifies a passkey assertion and logs the user in like
+// createSession. A user verifying passkey is already two factors, so no
+// TOTP challenge follows.
+func (cfg *apiConfig) finishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	throttleKey := passkeyThrottleKey(cfg.clientIP(r))
+	retryAfter, err := cfg.recordLoginAttempt(r.Context(), throttleKey)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter)
+		return
+	}
+
+	type parameters struct {
+		ChallengeID uuid.UUID `json:"challenge_id"`
+		UseCookies  bool      `json:"use_cookies"`
+		Credential  struct {
+			RawID    base64URL `json:"rawId"`
+			Response struct {
+				ClientDataJSON    base64URL `json:"clientDataJSON"`
+				AuthenticatorData base64URL `json:"authenticatorData"`
+				Signature         base64URL `json:"signature"`
+				UserHandle        base64URL `json:"userHandle"`
+			} `json:"response"`
+		} `json:"credential"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	credential, err := cfg.verifyPasskeyAssertion(r.Context(), params.ChallengeID, params.Credential.RawID,
+		params.Credential.Response.ClientDataJSON, params.Credential.Response.AuthenticatorData,
+		params.Credential.Response.Signature, params.Credential.Response.UserHandle)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrSignCountRegressed) {
+			log.Printf("Passkey %s of user %s may be cloned", credential.ID, credential.UserID)
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, err, "Couldn't verify passkey")
+		return
+	}
+
+	cfg.refundLoginAttempt(r.Context(), throttleKey)
+
+	user, err := cfg.sql.GetUserByID(r.Context(), credential.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+
+	cfg.writeSession(w, r, user, params.UseCookies)
+}
+
+// verifyPasskeyAssertion checks an assertion against the login challenge
+// and the stored credential and records the new sign count. The credential
+// is returned even on failure once it is known, for logging.
+func (cfg *apiConfig) verifyPasskeyAssertion(ctx context.Context, challengeID uuid.UUID, rawID, clientDataJSON, authenticatorData, signature, userHandle []byte) (database.WebauthnCredential, error) {
+	challenge, err := cfg.sql.ConsumeWebAuthnChallenge(ctx, database.ConsumeWebAuthnChallengeParams{
+		ID:       challengeID,
+		Ceremony: passkeyLogin,
+	})
+	if err != nil {
+		return database.WebauthnCredential{}, errors.New("login challenge invalid or expired")
+	}
+
+	credential, err := cfg.sql.GetWebAuthnCredentialByCredentialID(ctx, rawID)
+	if err != nil {
+		return database.WebauthnCredential{}, errors.New("unknown passkey")
+	}
+	if challenge.UserID.Valid && challenge.UserID.UUID != credential.UserID {
+		return credential, errors.New("passkey belongs to another user")
+	}
+	if len(userHandle) != 0 && string(userHandle) != string(credential.UserID[:]) {
+		return credential, errors.New("passkey user handle does not match")
+	}
+
+	signCount, err := cfg.relyingParty.VerifyAssertion(challenge.Challenge, webauthn.Credential{
+		ID:        credential.CredentialID,
+		PublicKey: credential.PublicKey,
+		SignCount: uint32(credential.SignCount),
+	}, clientDataJSON, authenticatorData, signature, true)
+	if err != nil {
+		return credential, err
+	}
+
+	err = cfg.sql.UpdateWebAuthnCredentialSignCount(ctx, database.UpdateWebAuthnCredentialSignCountParams{
+		ID:        credential.ID,
+		SignCount: int64(signCount),
+	})
+	if err != nil {
+		return credential, err
+	}
+
+	return credential, nil
+}
+
+func (cfg *apiConfig) prunePasskeyChallenges(ctx context.Context) error {
+	return cfg.sql.DeleteExpiredWebAuthnChallenges(ctx, time.Now())
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/mailer"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func passwordResetThrottleKey(email string) string {
+	return "reset:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func passwordResetIPThrottleKey(ip string) string {
+	return "reset-ip:" + ip
+}
+
+// forgotPassword emails a link to reset the password. Like magic links,
+// every request counts against the throttle of the address and the client.
+func (cfg *apiConfig) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type parameters struct {
+		Email string `json:"email"`
+	}
+
+	var params parameters
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	email := strings.TrimSpace(params.Email)
+	throttleKeys := []string{passwordResetThrottleKey(email), passwordResetIPThrottleKey(cfg.clientIP(r))}
+	retryAfter, err := cfg.recordLoginAttempt(r.Context(), throttleKeys...)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter)
+		return
+	}
+
+	// The response is the same whether or not the account exists.
+	user, err := cfg.sql.GetUserByEmail(r.Context(), email)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeSuccessJson(w, nil, http.StatusAccepted)
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	err = cfg.sql.CreatePasswordResetToken(r.Context(), database.CreatePasswordResetTokenParams{
+		TokenHash: auth.HashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	link := cfg.baseURL + "/app/reset-password/?token=" + url.QueryEscape(token)
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body:    fmt.Sprintf("Someone asked to reset the password of your Chirpy account.\n\nTo choose a new password, open this link within the next hour:\n\n%s\n\nIf you did not ask for this, you can ignore this email.\n", link),
+	})
+
+	writeSuccessJson(w, nil, http.StatusAccepted)
+}
+
+func (cfg *apiConfig) resetPassword(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type parameters struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	var params parameters
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	if params.Password == "" {
+		writeErrorJson(w, errors.New("password is empty"), "Password is required")
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.Hash(params.Password)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	err = cfg.resetUserPassword(r.Context(), auth.HashToken(params.Token), hashedPassword)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeErrorJson(w, err, "Invalid or expired token")
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	writeSuccessJson(w, nil, http.StatusNoContent)
+}
+
+// resetUserPassword spends the reset token, stores the new password hash and
+// logs the user out everywhere. Passkeys are removed too, in case one was
+// added from a hijacked session; the user registers them again after the
+// reset. It returns sql.ErrNoRows for a token that is unknown, used or
+// expired.
+func (cfg *apiConfig) resetUserPassword(ctx context.Context, tokenHash, hashedPassword string) error {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	q := cfg.sql.WithTx(tx)
+
+	resetToken, err := q.ConsumePasswordResetToken(ctx, tokenHash)
+	if err != nil {
+		return err
+	}
+
+	familyIDs, err := revokeAllCredentials(ctx, q, resetToken.UserID)
+	if err != nil {
+		return err
+	}
+
+	err = q.DeleteWebAuthnCredentialsByUserID(ctx, resetToken.UserID)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+		ID:             resetToken.UserID,
+		HashedPassword: hashedPassword,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	for _, familyID := range familyIDs {
+		err = cfg.revokeSessionAccessTokens(ctx, resetToken.UserID, familyID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeAllCredentials revokes every refresh token, personal access token
+// and reset link of the user. It returns the sessions whose access tokens
+// have to be denylisted with revokeSessionAccessTokens once the transaction
+// of q commits.
+func revokeAllCredentials(ctx context.Context, q *database.Queries, userID uuid.UUID) ([]uuid.UUID, error) {
+	familyIDs, err := q.RevokeAllSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = q.RevokePersonalAccessTokensByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = q.InvalidatePasswordResetTokensByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return familyIDs, nil
+}
+
+// loadPasswordHasher reads the argon2id parameters for new password hashes
+// from ARGON2_MEMORY_KIB, ARGON2_ITERATIONS and ARGON2_PARALLELISM, falling
+// back to auth.DefaultArgon2Params. Raising them makes every user's hash
+// upgrade on their next login.
+func loadPasswordHasher() (auth.PasswordHasher, error) {
+	params := auth.DefaultArgon2Params
+
+	settings := []struct {
+		env  string
+		bits int
+		set  func(uint64)
+	}{
+		{"ARGON2_MEMORY_KIB", 32, func(v uint64) { params.Memory = uint32(v) }},
+		{"ARGON2_ITERATIONS", 32, func(v uint64) { params.Iterations = uint32(v) }},
+		{"ARGON2_PARALLELISM", 8, func(v uint64) { params.Parallelism = uint8(v) }},
+	}
+	for _, setting := range settings {
+		value := os.Getenv(setting.env)
+		if value == "" {
+			continue
+		}
+		v, err := strconv.ParseUint(value, 10, setting.bits)
+		if err != nil || v == 0 {
+			return auth.PasswordHasher{}, fmt.Errorf("invalid %s: %q", setting.env, value)
+		}
+		setting.set(v)
+	}
+
+	return auth.PasswordHasher{Params: params}, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPasswordReset(t *testing.T) {
+	cfg, mail := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+	pat := createTestPAT(t, cfg, session.Token, auth.ScopeChirpsRead)
+
+	rr := serve(cfg.forgotPassword, newJSONRequest(http.MethodPost, "/api/password/forgot", map[string]any{
+		"email": "alice@example.com",
+	}))
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("forgot: status %d, want %d", rr.Code, http.StatusAccepted)
+	}
+	link := mail.link(t)
+
+	// The link opens the reset page served under /app.
+	page := httptest.NewRecorder()
+	http.StripPrefix("/app", http.FileServer(http.Dir("."))).ServeHTTP(page, httptest.NewRequest(http.MethodGet, strings.TrimPrefix(link, testBaseURL), nil))
+	if page.Code != http.StatusOK || !strings.Contains(page.Body.String(), "/api/password/reset") {
+		t.Fatalf("reset page: status %d, body %s", page.Code, page.Body)
+	}
+
+	reset := func() int {
+		return serve(cfg.resetPassword, newJSONRequest(http.MethodPost, "/api/password/reset", map[string]any{
+			"token":    tokenQuery(t, link),
+			"password": "a brand new password",
+		})).Code
+	}
+	if status := reset(); status != http.StatusNoContent {
+		t.Fatalf("reset: status %d, want %d", status, http.StatusNoContent)
+	}
+	if status := reset(); status != http.StatusBadRequest {
+		t.Errorf("reusing the reset link: status %d, want %d", status, http.StatusBadRequest)
+	}
+
+	// Every credential issued before the reset stops working.
+	for name, token := range map[string]string{"access token": session.Token, "personal access token": pat} {
+		_, err := cfg.authenticate(withBearer(newJSONRequest(http.MethodGet, "/api/chirps", nil), token))
+		if err == nil {
+			t.Errorf("%s still authenticates after the reset", name)
+		}
+	}
+	if _, status := refresh(cfg, session.RefreshToken); status != http.StatusUnauthorized {
+		t.Errorf("refresh after the reset: status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestForgotPasswordThrottle(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+
+	forgot := func(email string) *httptest.ResponseRecorder {
+		return serve(cfg.forgotPassword, newJSONRequest(http.MethodPost, "/api/password/forgot", map[string]any{
+			"email": email,
+		}))
+	}
+
+	// Unknown addresses count too, so the throttle tells nothing about
+	// which accounts exist.
+	for i := range cfg.loginPolicy.FreeAttempts + 1 {
+		if rr := forgot("nobody@example.com"); rr.Code != http.StatusAccepted {
+			t.Fatalf("request %d: status %d, want %d", i+1, rr.Code, http.StatusAccepted)
+		}
+	}
+
+	rr := forgot("nobody@example.com")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("throttled request: status %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("throttled request has no Retry-After header")
+	}
+
+	// Requests for other addresses are throttled by the client address.
+	if rr := forgot("other@example.com"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("other address from the same client: status %d, want %d", rr.Code, http.StatusTooManyRequests)
+	}
+
+	// Asking for a reset doesn't lock the account out of logging in.
+	createTestUser(t, cfg, "alice@example.com")
+	loginTestUser(t, cfg, "alice@example.com")
+}
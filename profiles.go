@@ -0,0 +1,230 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/account"
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/mailer"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// handleIndex keeps handles unique when two users claim one at once, after
+// both passed checkHandleAvailable.
+const handleIndex = "users_handle_idx"
+
+var errHandleTaken = errors.New("handle is already taken")
+
+func handleThrottleKey(handle string) string {
+	return "handle:" + strings.ToLower(strings.TrimSpace(handle))
+}
+
+// checkHandleAvailable returns errHandleTaken if a user other than userID
+// holds handle.
+func (cfg *apiConfig) checkHandleAvailable(r *http.Request, handle string, userID uuid.UUID) error {
+	owner, err := cfg.sql.GetUserByHandle(r.Context(), handle)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if owner.ID != userID {
+		return errHandleTaken
+	}
+	return nil
+}
+
+// showUser returns the public profile of a user, found by handle or ID.
+func (cfg *apiConfig) showUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	var user database.User
+	handleOrID := r.PathValue("handleOrID")
+	userID, err := uuid.Parse(handleOrID)
+	if err == nil {
+		user, err = cfg.sql.GetUserByID(r.Context(), userID)
+	} else {
+		user, err = cfg.sql.GetUserByHandle(r.Context(), handleOrID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "User not found")
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+	if user.DeletionRequestedAt.Valid {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, errAccountDeleted, "User not found")
+		return
+	}
+
+	chirpCount, err := cfg.sql.CountChirpsByUserID(r.Context(), user.ID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+
+	type response struct {
+		ID          uuid.UUID `json:"id"`
+		CreatedAt   time.Time `json:"created_at"`
+		Handle      string    `json:"handle,omitempty"`
+		DisplayName string    `json:"display_name"`
+		Bio         string    `json:"bio"`
+		Location    string    `json:"location"`
+		Website     string    `json:"website"`
+		IsChirpyRed bool      `json:"is_chirpy_red"`
+		ChirpCount  int64     `json:"chirp_count"`
+	}
+	resp := response{
+		ID:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		Handle:      user.Handle.String,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		Location:    user.Location,
+		Website:     user.Website,
+		IsChirpyRed: user.IsChirpyRed,
+		ChirpCount:  chirpCount,
+	}
+
+	writeSuccessJson(w, resp)
+}
+
+// updateProfile replaces the public profile of the caller. An empty handle
+// releases the current one.
+func (cfg *apiConfig) updateProfile(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorize(r, auth.ScopeProfileWrite)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Handle      string `json:"handle"`
+		DisplayName string `json:"display_name"`
+		Bio         string `json:"bio"`
+		Location    string `json:"location"`
+		Website     string `json:"website"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	profile := database.UpdateUserProfileParams{
+		ID:          caller.UserID,
+		DisplayName: strings.TrimSpace(params.DisplayName),
+		Bio:         strings.TrimSpace(params.Bio),
+		Location:    strings.TrimSpace(params.Location),
+		Website:     strings.TrimSpace(params.Website),
+	}
+
+	handle := strings.TrimSpace(params.Handle)
+	if handle != "" {
+		if !account.ValidHandle(handle) {
+			writeErrorJson(w, errors.New("handle is invalid"), "Handles are 3 to 30 letters, digits or underscores")
+			return
+		}
+		profile.Handle = sql.NullString{String: handle, Valid: true}
+	}
+	if utf8.RuneCountInString(profile.DisplayName) > account.MaxDisplayNameLength {
+		writeErrorJson(w, errors.New("display name is too long"), "Display name is too long")
+		return
+	}
+	if utf8.RuneCountInString(profile.Bio) > account.MaxBioLength {
+		writeErrorJson(w, errors.New("bio is too long"), "Bio is too long")
+		return
+	}
+	if utf8.RuneCountInString(profile.Location) > account.MaxLocationLength {
+		writeErrorJson(w, errors.New("location is too long"), "Location is too long")
+		return
+	}
+	if profile.Website != "" && !account.ValidWebsite(profile.Website) {
+		writeErrorJson(w, errors.New("website is invalid"), "Website must be an http or https URL")
+		return
+	}
+
+	if handle != "" {
+		err = cfg.checkHandleAvailable(r, handle, caller.UserID)
+		if errors.Is(err, errHandleTaken) {
+			w.WriteHeader(http.StatusConflict)
+			writeErrorJson(w, err, "Handle is already taken")
+			return
+		}
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+	}
+
+	user, err := cfg.sql.UpdateUserProfile(r.Context(), profile)
+	if uniqueViolation(err, handleIndex) {
+		w.WriteHeader(http.StatusConflict)
+		writeErrorJson(w, errHandleTaken, "Handle is already taken")
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't update profile")
+		return
+	}
+
+	type response struct {
+		ID          uuid.UUID `json:"id"`
+		UpdatedAt   time.Time `json:"updated_at"`
+		Handle      string    `json:"handle,omitempty"`
+		DisplayName string    `json:"display_name"`
+		Bio         string    `json:"bio"`
+		Location    string    `json:"location"`
+		Website     string    `json:"website"`
+	}
+	resp := response{user.ID, user.UpdatedAt, user.Handle.String, user.DisplayName, user.Bio, user.Location, user.Website}
+
+	writeSuccessJson(w, resp)
+}
+
+// notifyReleasedHandles tells users whose handle was released by a migration
+// to choose a new one. A notice is only dropped from the queue once it was
+// sent, so a mail outage delays it rather than losing it.
+func (cfg *apiConfig) notifyReleasedHandles(ctx context.Context) error {
+	released, err := cfg.sql.GetReleasedHandles(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range released {
+		err = cfg.mailer.Send(ctx, mailer.Message{
+			To:      r.Email,
+			Subject: "Choose a new Chirpy handle",
+			Body:    fmt.Sprintf("Your handle @%s is now the name of a Chirpy page, so your profile could not be found under it and it has been released.\n\nPlease choose a new handle in your profile settings. Your account and chirps are unaffected.\n", r.Handle),
+		})
+		if err != nil {
+			return err
+		}
+
+		err = cfg.sql.DeleteReleasedHandle(ctx, r.UserID)
+		if err != nil {
+			return err
+		}
+		log.Printf("Told user %s that handle %s was released", r.UserID, r.Handle)
+	}
+	return nil
+}
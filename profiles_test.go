@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// signUp creates an account with handle through the API.
+func signUp(cfg *apiConfig, email, handle string) int {
+	return serve(cfg.createUser, newJSONRequest(http.MethodPost, "/api/users", map[string]any{
+		"email":    email,
+		"password": testPassword,
+		"handle":   handle,
+	})).Code
+}
+
+func TestCreateUserHandle(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+
+	if status := signUp(cfg, "alice@example.com", "Alice"); status != http.StatusCreated {
+		t.Fatalf("claiming a free handle: status %d, want %d", status, http.StatusCreated)
+	}
+
+	tests := []struct {
+		name   string
+		handle string
+		want   int
+	}{
+		{"invalid characters", "b-o-b", http.StatusBadRequest},
+		{"too short", "bo", http.StatusBadRequest},
+		{"reserved", "Verify", http.StatusBadRequest},
+		{"taken", "Alice", http.StatusConflict},
+		{"taken in another case", "aLICE", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status := signUp(cfg, "bob@example.com", tt.handle); status != tt.want {
+				t.Errorf("status %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateProfileHandleIsCaseInsensitive(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	signUp(cfg, "alice@example.com", "alice")
+	createTestUser(t, cfg, "bob@example.com")
+	bob := loginTestUser(t, cfg, "bob@example.com")
+
+	rr := serve(cfg.updateProfile, withBearer(newJSONRequest(http.MethodPut, "/api/users/profile", map[string]any{
+		"handle": "ALICE",
+	}), bob.Token))
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("status %d, want %d", rr.Code, http.StatusConflict)
+	}
+
+	// Profiles are found whatever the case of the handle in the URL.
+	r := newJSONRequest(http.MethodGet, "/api/users/ALICE", nil)
+	r.SetPathValue("handleOrID", "ALICE")
+	rr = serve(cfg.showUser, r)
+	type response struct {
+		Handle string `json:"handle"`
+	}
+	if rr.Code != http.StatusOK || decodeBody[response](t, rr).Handle != "alice" {
+		t.Errorf("profile by handle: status %d, body %s", rr.Code, rr.Body)
+	}
+}
+
+func TestLoginByHandle(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	signUp(cfg, "alice@example.com", "Alice")
+
+	tests := []struct {
+		name     string
+		handle   string
+		password string
+		want     int
+	}{
+		{"exact handle", "Alice", testPassword, http.StatusOK},
+		{"handle in another case", "alice", testPassword, http.StatusOK},
+		{"wrong password", "Alice", "not the password", http.StatusUnauthorized},
+		{"unknown handle", "bob", testPassword, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(cfg.createSession, newJSONRequest(http.MethodPost, "/api/login", map[string]any{
+				"handle":   tt.handle,
+				"password": tt.password,
+			}))
+			if rr.Code != tt.want {
+				t.Errorf("status %d, want %d, body %s", rr.Code, tt.want, rr.Body)
+			}
+		})
+	}
+}
+
+func TestNotifyReleasedHandles(t *testing.T) {
+	cfg, mail := newTestConfig(t)
+	user := createTestUser(t, cfg, "alice@example.com")
+	ctx := context.Background()
+
+	_, err := cfg.db.ExecContext(ctx, `INSERT INTO released_handles (user_id, handle, released_at) VALUES ($1, 'verify', NOW())`, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = cfg.notifyReleasedHandles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := mail.next(t)
+	if msg.To != "alice@example.com" || !strings.Contains(msg.Body, "@verify") {
+		t.Errorf("notice = %+v", msg)
+	}
+
+	// Each user is told once.
+	err = cfg.notifyReleasedHandles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-mail.sent:
+		t.Errorf("second notice sent: %+v", msg)
+	default:
+	}
+}
@@ -3,8 +3,12 @@ package main
 import (
 	"codingiam/chirpy/internal/auth"
 	"codingiam/chirpy/internal/database"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"io"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -17,7 +21,11 @@ func (cfg *apiConfig) createSession(w http.ResponseWriter, r *http.Request) {
 
 	type parameters struct {
 		Password string `json:"password"`
-		Email    string `json:"email"`
+		// Users log in with either their email or their handle.
+		Email  string `json:"email"`
+		Handle string `json:"handle"`
+		// UseCookies keeps the session in cookies instead of returning the tokens.
+		UseCookies bool `json:"use_cookies"`
 	}
 
 	var params parameters
@@ -27,42 +35,163 @@ func (cfg *apiConfig) createSession(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	email := strings.TrimSpace(params.Email)
-	if len(email) < 5 {
-		writeErrorJson(w, errors.New("email is too short"), "Email is too short")
-		return
+	// Failures count against the account's email either way, so switching
+	// between email and handle doesn't buy extra attempts.
+	var user database.User
+	var accountKey string
+	if handle := strings.TrimSpace(params.Handle); handle != "" {
+		user, err = cfg.sql.GetUserByHandle(r.Context(), handle)
+		accountKey = handleThrottleKey(handle)
+		if err == nil {
+			accountKey = emailThrottleKey(user.Email)
+		}
+	} else {
+		email := strings.TrimSpace(params.Email)
+		if len(email) < 5 {
+			writeErrorJson(w, errors.New("email is too short"), "Email is too short")
+			return
+		}
+		user, err = cfg.sql.GetUserByEmail(r.Context(), email)
+		accountKey = emailThrottleKey(email)
 	}
+	lookupErr := err
 
-	user, err := cfg.sql.GetUserByEmail(r.Context(), email)
+	ipKey := ipThrottleKey(cfg.clientIP(r))
+	retryAfter, err := cfg.recordLoginAttempt(r.Context(), accountKey, ipKey)
 	if err != nil {
-		writeErrorJson(w, err, "Couldn't get user")
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter)
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	if lookupErr != nil {
+		if !errors.Is(lookupErr, sql.ErrNoRows) {
+			cfg.refundLoginAttempt(r.Context(), accountKey, ipKey)
+		}
+		writeErrorJson(w, lookupErr, "Couldn't get user")
+		return
+	}
+
+	needsRehash, err := cfg.passwords.Verify(params.Password, user.HashedPassword)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		writeErrorJson(w, err, "Incorrect email or password")
 		return
 	}
 
-	duration := 1 * time.Hour
-	jwt, err := auth.MakeJWT(user.ID, cfg.secret, duration)
+	cfg.clearLoginFailures(r.Context(), accountKey)
+	cfg.refundLoginAttempt(r.Context(), ipKey)
+
+	if needsRehash {
+		cfg.rehashPassword(r.Context(), user, params.Password)
+	}
+
+	cfg.completeLogin(w, r, user, params.UseCookies)
+}
+
+// completeLogin finishes a login once the user proved their first factor,
+// either by starting the session or by asking for the second factor.
+func (cfg *apiConfig) completeLogin(w http.ResponseWriter, r *http.Request, user database.User, useCookies bool) {
+	totp, err := cfg.sql.GetUserTOTP(r.Context(), user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	// With a second factor enrolled the first factor only earns a challenge
+	// token, which is exchanged for a session in verifyTwoFactorSession.
+	if err == nil && totp.ConfirmedAt.Valid {
+		challenge, err := auth.MakeChallengeJWT(user.ID, cfg.keys, 5*time.Minute)
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+
+		type response struct {
+			TwoFactorRequired bool   `json:"two_factor_required"`
+			ChallengeToken    string `json:"challenge_token"`
+		}
+		resp := response{true, challenge}
+
+		writeSuccessJson(w, resp, http.StatusAccepted)
+		return
+	}
+
+	cfg.writeSession(w, r, user, useCookies)
+}
+
+// rehashPassword upgrades the stored hash of a user who just proved their
+// password. Failing to do so is not fatal for the login.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, user database.User, password string) {
+	hashedPassword, err := cfg.passwords.Hash(password)
+	if err != nil {
+		log.Printf("Error rehashing password: %s", err)
+		return
+	}
+
+	_, err = cfg.sql.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{ID: user.ID, HashedPassword: hashedPassword})
+	if err != nil {
+		log.Printf("Error storing rehashed password: %s", err)
+	}
+}
+
+// Lifetimes of the tokens of a login session.
+const (
+	accessTokenDuration  = 1 * time.Hour
+	refreshTokenDuration = 60 * 24 * time.Hour
+)
+
+// writeSession logs the user in by responding with a new access token and
+// a refresh token starting a new token family, which is the session. With
+// useCookies the tokens are set as cookies and left out of the response. A
+// DPoP proof sent with r binds the session to the proof key. Logging in
+// restores an account that is waiting to be deleted.
+func (cfg *apiConfig) writeSession(w http.ResponseWriter, r *http.Request, user database.User, useCookies bool) {
+	// Magic links and SSO callbacks end in a GET from another site. Their
+	// cookie logins are checked where the flow starts, and the flow is bound
+	// to the browser by a cookie set there.
+	if useCookies && r.Method != http.MethodGet {
+		err := checkCookieLogin(r)
+		if err != nil {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			writeErrorJson(w, err, "Send the login as JSON")
+			return
+		}
+	}
+
+	jkt, err := cfg.requestDPoPKey(r, "")
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	user, err = cfg.restoreUser(r.Context(), user)
+	if errors.Is(err, errAccountDeleted) {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, err, "This account has been deleted")
+		return
+	}
 	if err != nil {
 		writeErrorJson(w, err, "Something went wrong")
 		return
 	}
 
-	token, err := auth.MakeRefreshToken()
+	sessionID := uuid.New()
+	jwt, err := cfg.makeSessionJWT(user, sessionID, jkt)
 	if err != nil {
 		writeErrorJson(w, err, "Something went wrong")
 		return
 	}
 
-	_, err = cfg.sql.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:     token,
+	token, err := issueRefreshToken(r.Context(), cfg.sql, database.CreateRefreshTokenParams{
 		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(60 * 24 * time.Hour),
+		FamilyID:  sessionID,
+		UserAgent: userAgent(r),
+		IpAddress: cfg.clientIP(r),
+		DpopJkt:   jkt,
 	})
 	if err != nil {
 		writeErrorJson(w, err, "Something went wrong")
@@ -74,11 +203,25 @@ func (cfg *apiConfig) createSession(w http.ResponseWriter, r *http.Request) {
 		CreatedAt    time.Time `json:"created_at"`
 		UpdatedAt    time.Time `json:"updated_at"`
 		Email        string    `json:"email"`
-		Token        string    `json:"token"`
-		RefreshToken string    `json:"refresh_token"`
+		Token        string    `json:"token,omitempty"`
+		RefreshToken string    `json:"refresh_token,omitempty"`
 		IsChirpyRed  bool      `json:"is_chirpy_red"`
+		Role         string    `json:"role"`
+		TokenType    string    `json:"token_type,omitempty"`
+	}
+	resp := response{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, jwt, token, user.IsChirpyRed, user.Role, ""}
+	if jkt != "" {
+		resp.TokenType = "DPoP"
+	}
+
+	if useCookies {
+		err = cfg.setSessionCookies(w, jwt, token)
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+		resp.Token, resp.RefreshToken = "", ""
 	}
-	resp := response{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, jwt, token, user.IsChirpyRed}
 
 	writeSuccessJson(w, resp)
 }
@@ -86,31 +229,101 @@ func (cfg *apiConfig) createSession(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) refreshSession(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	token, err := auth.GetBearerToken(r.Header)
+	token, fromCookie, err := requestToken(r, refreshTokenCookie)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	refreshToken, err := cfg.sql.GetRefreshTokenByHashIncludingRevoked(r.Context(), auth.HashToken(token))
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		writeErrorJson(w, err, "Something went wrong")
 		return
 	}
 
-	refreshToken, err := cfg.sql.GetRefreshTokenByToken(r.Context(), token)
-	if err != nil || refreshToken.ExpiresAt.Before(time.Now()) {
+	// A revoked token coming back means it was copied before it got rotated
+	// (or logged out), so nothing issued from it can be trusted any more.
+	if refreshToken.RevokedAt.Valid {
+		cfg.revokeRefreshTokenFamily(r, refreshToken.UserID, refreshToken.FamilyID)
 		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, errors.New("refresh token reused"), "Something went wrong")
+		return
+	}
+
+	if refreshToken.ExpiresAt.Before(time.Now()) {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, errors.New("refresh token expired"), "Something went wrong")
+		return
+	}
+
+	// Tokens issued to OAuth clients are refreshed at /oauth/token, which
+	// keeps their scopes.
+	if refreshToken.ClientID.Valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, errors.New("refresh token belongs to an oauth client"), "Something went wrong")
+		return
+	}
+
+	// A session bound to a DPoP key stays bound to it; an unbound one cannot
+	// be bound later on.
+	jkt, err := cfg.requestDPoPKey(r, "")
+	if err == nil && jkt != refreshToken.DpopJkt {
+		err = errDPoPKeyMismatch
+		if refreshToken.DpopJkt == "" {
+			err = errDPoPUnbound
+		}
+	}
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	newToken, err := cfg.rotateRefreshToken(r, refreshToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Someone else rotated the token between our read and the update.
+		cfg.revokeRefreshTokenFamily(r, refreshToken.UserID, refreshToken.FamilyID)
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, errors.New("refresh token reused"), "Something went wrong")
+		return
+	}
+	if err != nil {
 		writeErrorJson(w, err, "Something went wrong")
 		return
 	}
 
-	duration := 1 * time.Hour
-	jwt, err := auth.MakeJWT(refreshToken.UserID, cfg.secret, duration)
+	// The role is looked up again so that role changes apply on refresh.
+	user, err := cfg.sql.GetUserByID(r.Context(), refreshToken.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+
+	jwt, err := cfg.makeSessionJWT(user, refreshToken.FamilyID, refreshToken.DpopJkt)
 	if err != nil {
 		writeErrorJson(w, err, "Something went wrong")
 		return
 	}
 
+	if fromCookie {
+		err = cfg.setSessionCookies(w, jwt, newToken)
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+		writeSuccessJson(w, nil, http.StatusNoContent)
+		return
+	}
+
 	type response struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+		TokenType    string `json:"token_type,omitempty"`
+	}
+	resp := response{jwt, newToken, ""}
+	if refreshToken.DpopJkt != "" {
+		resp.TokenType = "DPoP"
 	}
-	resp := response{jwt}
 
 	writeSuccessJson(w, resp)
 }
@@ -118,24 +331,175 @@ func (cfg *apiConfig) refreshSession(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) revokeSession(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	token, err := auth.GetBearerToken(r.Header)
+	token, fromCookie, err := requestToken(r, refreshTokenCookie)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		writeErrorJson(w, err, "Something went wrong")
+		writeAuthError(w, err)
 		return
 	}
 
-	refreshToken, err := cfg.sql.GetRefreshTokenByToken(r.Context(), token)
+	refreshToken, err := cfg.sql.GetRefreshTokenByHash(r.Context(), auth.HashToken(token))
 	if err != nil || refreshToken.ExpiresAt.Before(time.Now()) {
 		w.WriteHeader(http.StatusUnauthorized)
 		writeErrorJson(w, err, "Something went wrong")
 		return
 	}
 
-	_, err = cfg.sql.RevokeRefreshTokenByToken(r.Context(), token)
+	// The access token issued alongside the refresh token can be passed in
+	// the body so that it stops working right away instead of at expiry.
+	type parameters struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	_, err = cfg.sql.RevokeRefreshTokenByHash(r.Context(), refreshToken.TokenHash)
 	if err != nil {
 		writeErrorJson(w, err, "Something went wrong")
 		return
 	}
+
+	// The access token cookie cannot be read by the app, so logging out of a
+	// cookie session revokes every access token of the session.
+	if fromCookie {
+		cfg.clearSessionCookies(w)
+		err = cfg.revokeSessionAccessTokens(r.Context(), refreshToken.UserID, refreshToken.FamilyID)
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+	}
+
+	if params.AccessToken != "" {
+		claims, err := auth.ParseJWT(params.AccessToken, cfg.keys, cfg.jwtOptions)
+		if err != nil {
+			log.Printf("Not revoking access token: %s", err)
+		} else if claims.UserID() != refreshToken.UserID {
+			log.Printf("Not revoking access token of another user")
+		} else {
+			err = cfg.denylist.Revoke(r.Context(), claims.ID, claims.UserID(), claims.ExpiresAt.Time)
+			if err != nil {
+				writeErrorJson(w, err, "Something went wrong")
+				return
+			}
+		}
+	}
+
 	writeSuccessJson(w, nil, http.StatusNoContent)
 }
+
+// makeSessionJWT returns an access token for the login session sessionID,
+// bound to the DPoP key with thumbprint jkt unless that is empty.
+func (cfg *apiConfig) makeSessionJWT(user database.User, sessionID uuid.UUID, jkt string) (string, error) {
+	if jkt != "" {
+		return auth.MakeBoundJWT(user.ID, sessionID, user.Role, jkt, cfg.keys, accessTokenDuration)
+	}
+	return auth.MakeJWT(user.ID, sessionID, user.Role, cfg.keys, accessTokenDuration)
+}
+
+// issueRefreshToken creates a new refresh token for the user in the token
+// family of params, filling in the token hash and its expiry. Logins start a
+// new family, rotations continue the old one. Only the hash is stored, so the
+// returned token cannot be recovered from the database.
+func issueRefreshToken(ctx context.Context, q *database.Queries, params database.CreateRefreshTokenParams) (string, error) {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return "", err
+	}
+
+	params.TokenHash = auth.HashToken(token)
+	params.ExpiresAt = time.Now().Add(refreshTokenDuration)
+	_, err = q.CreateRefreshToken(ctx, params)
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// rotateRefreshToken replaces old with a fresh token from the same family,
+// client and scopes, recording the client that sent r as its last user. It
+// returns sql.ErrNoRows if old was revoked concurrently.
+func (cfg *apiConfig) rotateRefreshToken(r *http.Request, old database.RefreshToken) (string, error) {
+	ctx := r.Context()
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	q := cfg.sql.WithTx(tx)
+
+	token, err := issueRefreshToken(ctx, q, database.CreateRefreshTokenParams{
+		UserID:    old.UserID,
+		FamilyID:  old.FamilyID,
+		ClientID:  old.ClientID,
+		Scopes:    old.Scopes,
+		UserAgent: userAgent(r),
+		IpAddress: cfg.clientIP(r),
+		DpopJkt:   old.DpopJkt,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	_, err = q.RotateRefreshToken(ctx, database.RotateRefreshTokenParams{
+		TokenHash:  old.TokenHash,
+		ReplacedBy: sql.NullString{String: auth.HashToken(token), Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, tx.Commit()
+}
+
+// revokeRefreshTokenFamily ends a session after one of its tokens was
+// reused.
+func (cfg *apiConfig) revokeRefreshTokenFamily(r *http.Request, userID, familyID uuid.UUID) {
+	log.Printf("Token reuse detected, revoking family %s", familyID)
+
+	err := cfg.sql.RevokeRefreshTokenFamily(r.Context(), familyID)
+	if err != nil {
+		log.Printf("Error: %s", err)
+	}
+
+	err = cfg.revokeSessionAccessTokens(r.Context(), userID, familyID)
+	if err != nil {
+		log.Printf("Error: %s", err)
+	}
+}
+
+// revokeSessionAccessTokens denylists the session id carried by the access
+// tokens of a token family, so they stop working before they expire.
+func (cfg *apiConfig) revokeSessionAccessTokens(ctx context.Context, userID, familyID uuid.UUID) error {
+	return cfg.denylist.Revoke(ctx, familyID.String(), userID, time.Now().Add(accessTokenDuration+time.Minute))
+}
+
+// revokeOtherSessions ends every login session of the user except keep.
+func (cfg *apiConfig) revokeOtherSessions(ctx context.Context, userID, keep uuid.UUID) error {
+	familyIDs, err := cfg.sql.RevokeOtherSessions(ctx, database.RevokeOtherSessionsParams{UserID: userID, FamilyID: keep})
+	if err != nil {
+		return err
+	}
+
+	for _, familyID := range familyIDs {
+		err = cfg.revokeSessionAccessTokens(ctx, userID, familyID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userAgent returns the User-Agent of r, shortened for storage.
+func userAgent(r *http.Request) string {
+	ua := r.UserAgent()
+	if len(ua) > 512 {
+		ua = ua[:512]
+	}
+	return ua
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// refresh exchanges refreshToken at /api/refresh.
+func refresh(cfg *apiConfig, refreshToken string) (sessionTokens, int) {
+	rr := serve(cfg.refreshSession, withBearer(newJSONRequest(http.MethodPost, "/api/refresh", nil), refreshToken))
+	var tokens sessionTokens
+	if rr.Code == http.StatusOK {
+		_ = json.Unmarshal(rr.Body.Bytes(), &tokens)
+	}
+	return tokens, rr.Code
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+	login := loginTestUser(t, cfg, "alice@example.com")
+
+	rotated, status := refresh(cfg, login.RefreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("refresh: status %d, want %d", status, http.StatusOK)
+	}
+	if rotated.RefreshToken == "" || rotated.RefreshToken == login.RefreshToken {
+		t.Fatalf("refresh returned refresh token %q, want a new one", rotated.RefreshToken)
+	}
+
+	_, status = refresh(cfg, rotated.RefreshToken)
+	if status != http.StatusOK {
+		t.Errorf("refresh with rotated token: status %d, want %d", status, http.StatusOK)
+	}
+}
+
+func TestRefreshTokenReuseRevokesFamily(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+	stolen := loginTestUser(t, cfg, "alice@example.com")
+	other := loginTestUser(t, cfg, "alice@example.com")
+
+	rotated, status := refresh(cfg, stolen.RefreshToken)
+	if status != http.StatusOK {
+		t.Fatalf("refresh: status %d, want %d", status, http.StatusOK)
+	}
+
+	// Replaying the rotated token is the sign that it was copied.
+	_, status = refresh(cfg, stolen.RefreshToken)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("reused refresh token: status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	_, status = refresh(cfg, rotated.RefreshToken)
+	if status != http.StatusUnauthorized {
+		t.Errorf("refresh token of the revoked family: status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	for _, token := range []string{stolen.Token, rotated.Token} {
+		_, err := cfg.authenticate(withBearer(newJSONRequest(http.MethodGet, "/api/chirps", nil), token))
+		if err == nil {
+			t.Error("access token of the revoked family still authenticates")
+		}
+	}
+
+	// Other sessions of the user are not affected.
+	_, err := cfg.authenticate(withBearer(newJSONRequest(http.MethodGet, "/api/chirps", nil), other.Token))
+	if err != nil {
+		t.Errorf("access token of another session: %s", err)
+	}
+	_, status = refresh(cfg, other.RefreshToken)
+	if status != http.StatusOK {
+		t.Errorf("refresh token of another session: status %d, want %d", status, http.StatusOK)
+	}
+}
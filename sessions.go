@@ -0,0 +1,112 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/database"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// indexSessions lists the devices the caller is logged in on. Each login
+// is a refresh token family, identified by its family id.
+func (cfg *apiConfig) indexSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	sessions, err := cfg.sql.GetSessionsByUserID(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	type session struct {
+		ID         uuid.UUID `json:"id"`
+		CreatedAt  time.Time `json:"created_at"`
+		LastUsedAt time.Time `json:"last_used_at"`
+		ExpiresAt  time.Time `json:"expires_at"`
+		UserAgent  string    `json:"user_agent"`
+		IPAddress  string    `json:"ip_address"`
+		Current    bool      `json:"current"`
+	}
+
+	resp := []session{}
+	for _, s := range sessions {
+		resp = append(resp, session{
+			ID:         s.FamilyID,
+			CreatedAt:  s.CreatedAt,
+			LastUsedAt: s.LastUsedAt,
+			ExpiresAt:  s.ExpiresAt,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IpAddress,
+			Current:    s.FamilyID == caller.SessionID(),
+		})
+	}
+
+	writeSuccessJson(w, resp)
+}
+
+func (cfg *apiConfig) deleteSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	sessionID, err := uuid.Parse(r.PathValue("sessionID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	rows, err := cfg.sql.RevokeSession(r.Context(), database.RevokeSessionParams{
+		FamilyID: sessionID,
+		UserID:   caller.UserID,
+	})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if rows == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, errors.New("session not found"), "Something went wrong")
+		return
+	}
+
+	err = cfg.revokeSessionAccessTokens(r.Context(), caller.UserID, sessionID)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	writeSuccessJson(w, nil, http.StatusNoContent)
+}
+
+// deleteOtherSessions logs the caller out everywhere except on the session
+// making the request.
+func (cfg *apiConfig) deleteOtherSessions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	err = cfg.revokeOtherSessions(r.Context(), caller.UserID, caller.SessionID())
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	writeSuccessJson(w, nil, http.StatusNoContent)
+}
@@ -22,3 +22,6 @@ SELECT * FROM chirps WHERE id = $1;
 
 -- name: DeleteChirpByID :exec
 DELETE FROM chirps WHERE id = $1;
+
+-- name: CountChirpsByUserID :one
+SELECT COUNT(*) FROM chirps WHERE user_id = $1;
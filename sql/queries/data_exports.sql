@@ -0,0 +1,42 @@
+-- name: CreateDataExport :one
+INSERT INTO data_exports (id, created_at, updated_at, user_id, status)
+VALUES (gen_random_uuid(),
+        NOW(),
+        NOW(),
+        $1,
+        'pending')
+RETURNING *;
+
+-- name: GetDataExportByID :one
+SELECT * FROM data_exports WHERE id = $1;
+
+-- name: GetActiveDataExportByUserID :one
+SELECT * FROM data_exports
+WHERE user_id = $1 AND status IN ('pending', 'running')
+ORDER BY created_at DESC
+LIMIT 1;
+
+-- name: ClaimDataExport :one
+UPDATE data_exports SET updated_at = NOW(), status = 'running'
+WHERE id = (
+    SELECT e.id FROM data_exports e
+    WHERE e.status = 'pending' OR (e.status = 'running' AND e.updated_at < sqlc.arg(stale_before)::timestamp)
+    ORDER BY e.created_at
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CompleteDataExport :exec
+UPDATE data_exports SET updated_at = NOW(), status = 'ready', archive = $2, completed_at = NOW(), expires_at = $3
+WHERE id = $1;
+
+-- name: FailDataExport :exec
+UPDATE data_exports SET updated_at = NOW(), status = 'failed' WHERE id = $1;
+
+-- name: DeleteExpiredDataExports :exec
+DELETE FROM data_exports
+WHERE expires_at < NOW() OR (status = 'failed' AND updated_at < NOW() - INTERVAL '1 day');
+
+-- name: DeleteDataExportsByUserID :exec
+DELETE FROM data_exports WHERE user_id = $1;
@@ -0,0 +1,27 @@
+-- name: CreateEmailChange :one
+INSERT INTO email_changes (id, created_at, user_id, old_email, new_email)
+VALUES (gen_random_uuid(),
+        NOW(),
+        $1,
+        $2,
+        $3)
+RETURNING *;
+
+-- name: DeletePendingEmailChanges :exec
+DELETE FROM email_changes WHERE user_id = $1 AND confirmed_at IS NULL;
+
+-- name: ConfirmEmailChange :one
+UPDATE email_changes SET confirmed_at = NOW()
+WHERE id = $1 AND confirmed_at IS NULL
+RETURNING *;
+
+-- name: RevertEmailChange :one
+UPDATE email_changes SET reverted_at = NOW()
+WHERE id = $1 AND confirmed_at IS NOT NULL AND reverted_at IS NULL
+RETURNING *;
+
+-- name: DeleteStaleEmailChanges :exec
+DELETE FROM email_changes WHERE created_at < $1;
+
+-- name: GetEmailChangesByUserID :many
+SELECT * FROM email_changes WHERE user_id = $1 ORDER BY created_at;
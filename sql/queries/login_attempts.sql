@@ -0,0 +1,29 @@
+-- name: GetLoginAttempts :many
+SELECT * FROM login_attempts WHERE throttle_key = ANY(sqlc.arg(throttle_keys)::text[]);
+
+-- name: RecordLoginAttempt :one
+INSERT INTO login_attempts (throttle_key, failures, last_failed_at, blocked_until)
+VALUES (sqlc.arg(throttle_key),
+        1,
+        NOW(),
+        NOW() + make_interval(secs => COALESCE((sqlc.arg(delays)::float8[])[1], 0)))
+ON CONFLICT (throttle_key) DO UPDATE SET
+    failures = CASE WHEN login_attempts.last_failed_at < sqlc.arg(reset_before)::timestamp THEN 1 ELSE login_attempts.failures + 1 END,
+    last_failed_at = NOW(),
+    blocked_until = NOW() + make_interval(secs => COALESCE((sqlc.arg(delays)::float8[])[LEAST(
+        CASE WHEN login_attempts.last_failed_at < sqlc.arg(reset_before)::timestamp THEN 1 ELSE login_attempts.failures + 1 END,
+        cardinality(sqlc.arg(delays)::float8[]))], 0))
+WHERE login_attempts.blocked_until <= NOW()
+RETURNING *;
+
+-- name: RefundLoginAttempt :exec
+UPDATE login_attempts SET
+    failures = failures - 1,
+    blocked_until = last_failed_at + make_interval(secs => COALESCE((sqlc.arg(delays)::float8[])[LEAST(failures - 1, cardinality(sqlc.arg(delays)::float8[]))], 0))
+WHERE throttle_key = sqlc.arg(throttle_key) AND failures > 0;
+
+-- name: DeleteLoginAttempts :execrows
+DELETE FROM login_attempts WHERE throttle_key = $1;
+
+-- name: DeleteStaleLoginAttempts :exec
+DELETE FROM login_attempts WHERE last_failed_at < $1 AND blocked_until < NOW();
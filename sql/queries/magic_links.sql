@@ -0,0 +1,20 @@
+-- name: CreateMagicLink :one
+INSERT INTO magic_links (id, created_at, user_id, nonce_hash, use_cookies, expires_at)
+VALUES (gen_random_uuid(),
+        NOW(),
+        $1,
+        $2,
+        $3,
+        $4)
+RETURNING *;
+
+-- name: ConsumeMagicLink :one
+UPDATE magic_links SET used_at = NOW()
+WHERE id = $1 AND nonce_hash = $2 AND used_at IS NULL AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredMagicLinks :exec
+DELETE FROM magic_links WHERE expires_at < $1;
+
+-- name: DeleteMagicLinksByUserID :exec
+DELETE FROM magic_links WHERE user_id = $1;
@@ -0,0 +1,21 @@
+-- name: CreateOAuthAuthorizationCode :exec
+INSERT INTO oauth_authorization_codes (code_hash, created_at, client_id, user_id, redirect_uri, scopes, code_challenge, family_id, expires_at)
+VALUES ($1,
+        NOW(),
+        $2,
+        $3,
+        $4,
+        $5,
+        $6,
+        $7,
+        $8);
+
+-- name: GetOAuthAuthorizationCode :one
+SELECT * FROM oauth_authorization_codes WHERE code_hash = $1;
+
+-- name: ConsumeOAuthAuthorizationCode :one
+UPDATE oauth_authorization_codes SET used_at = NOW() WHERE code_hash = $1 AND used_at IS NULL
+RETURNING *;
+
+-- name: DeleteExpiredOAuthAuthorizationCodes :exec
+DELETE FROM oauth_authorization_codes WHERE expires_at < $1;
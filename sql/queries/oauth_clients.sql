@@ -0,0 +1,20 @@
+-- name: CreateOAuthClient :one
+INSERT INTO oauth_clients (id, created_at, updated_at, user_id, name, secret_hash, redirect_uris, scopes)
+VALUES (gen_random_uuid(),
+        NOW(),
+        NOW(),
+        $1,
+        $2,
+        $3,
+        $4,
+        $5)
+RETURNING *;
+
+-- name: GetOAuthClientByID :one
+SELECT * FROM oauth_clients WHERE id = $1;
+
+-- name: GetOAuthClientsByUserID :many
+SELECT * FROM oauth_clients WHERE user_id = $1 ORDER BY created_at DESC;
+
+-- name: DeleteOAuthClient :execrows
+DELETE FROM oauth_clients WHERE id = $1 AND user_id = $2;
@@ -0,0 +1,30 @@
+-- name: CreatePersonalAccessToken :one
+INSERT INTO personal_access_tokens (id, created_at, updated_at, user_id, name, token_hash, scopes, expires_at)
+VALUES (gen_random_uuid(),
+        NOW(),
+        NOW(),
+        $1,
+        $2,
+        $3,
+        $4,
+        $5)
+RETURNING *;
+
+-- name: GetPersonalAccessTokenByHash :one
+SELECT * FROM personal_access_tokens
+WHERE token_hash = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW());
+
+-- name: GetPersonalAccessTokensByUserID :many
+SELECT * FROM personal_access_tokens
+WHERE user_id = $1 AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > NOW())
+ORDER BY created_at DESC;
+
+-- name: TouchPersonalAccessToken :exec
+UPDATE personal_access_tokens SET last_used_at = NOW()
+WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute');
+
+-- name: RevokePersonalAccessToken :execrows
+UPDATE personal_access_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL;
+
+-- name: RevokePersonalAccessTokensByUserID :exec
+UPDATE personal_access_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;
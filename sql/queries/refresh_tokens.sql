@@ -1,15 +1,74 @@
 -- name: CreateRefreshToken :one
-INSERT INTO refresh_tokens (token, created_at, updated_at, user_id, expires_at)
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, family_id, client_id, scopes, user_agent, ip_address, last_used_at, dpop_jkt)
 VALUES ($1,
         NOW(),
         NOW(),
         $2,
-        $3)
+        $3,
+        $4,
+        $5,
+        $6,
+        $7,
+        $8,
+        NOW(),
+        $9)
 RETURNING *;
 
--- name: GetRefreshTokenByToken :one
-SELECT * FROM refresh_tokens WHERE token = $1 AND revoked_at IS NULL;
+-- name: GetRefreshTokenByHash :one
+SELECT * FROM refresh_tokens WHERE token_hash = $1 AND revoked_at IS NULL;
+
+-- name: GetRefreshTokenByHashIncludingRevoked :one
+SELECT * FROM refresh_tokens WHERE token_hash = $1;
+
+-- name: RevokeRefreshTokenByHash :one
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE token_hash = $1 AND revoked_at IS NULL
+RETURNING *;
 
--- name: RevokeRefreshTokenByToken :one
-UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE token = $1 AND revoked_at IS NULL
+-- name: RotateRefreshToken :one
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW(), replaced_by = $2 WHERE token_hash = $1 AND revoked_at IS NULL
 RETURNING *;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokensByUserID :exec
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: GetSessionsByUserID :many
+SELECT t.family_id,
+       t.user_agent,
+       t.ip_address,
+       t.last_used_at,
+       t.expires_at,
+       (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = t.family_id)::timestamp AS created_at
+FROM refresh_tokens t
+WHERE t.user_id = $1 AND t.client_id IS NULL AND t.revoked_at IS NULL AND t.expires_at > NOW()
+ORDER BY t.last_used_at DESC;
+
+-- name: RevokeSession :execrows
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW()
+WHERE family_id = $1 AND user_id = $2 AND client_id IS NULL AND revoked_at IS NULL;
+
+-- name: RevokeOtherSessions :many
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND family_id <> $2 AND client_id IS NULL AND revoked_at IS NULL
+RETURNING family_id;
+
+-- name: RevokeAllSessions :many
+UPDATE refresh_tokens SET updated_at = NOW(), revoked_at = NOW()
+WHERE user_id = $1 AND revoked_at IS NULL
+RETURNING family_id;
+
+-- name: GetSessionHistoryByUserID :many
+SELECT DISTINCT ON (t.family_id)
+       t.family_id,
+       t.client_id,
+       t.user_agent,
+       t.ip_address,
+       t.last_used_at,
+       t.expires_at,
+       t.revoked_at,
+       (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = t.family_id)::timestamp AS created_at
+FROM refresh_tokens t
+WHERE t.user_id = $1
+ORDER BY t.family_id, t.created_at DESC;
@@ -0,0 +1,8 @@
+-- name: GetReleasedHandles :many
+SELECT released_handles.user_id, released_handles.handle, users.email
+FROM released_handles
+JOIN users ON users.id = released_handles.user_id
+ORDER BY released_handles.released_at;
+
+-- name: DeleteReleasedHandle :exec
+DELETE FROM released_handles WHERE user_id = $1;
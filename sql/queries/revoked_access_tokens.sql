@@ -0,0 +1,13 @@
+-- name: CreateRevokedAccessToken :exec
+INSERT INTO revoked_access_tokens (jti, created_at, user_id, expires_at)
+VALUES ($1,
+        NOW(),
+        $2,
+        $3)
+ON CONFLICT (jti) DO NOTHING;
+
+-- name: GetRevokedAccessTokensSince :many
+SELECT jti, expires_at FROM revoked_access_tokens WHERE created_at >= $1 AND expires_at > NOW();
+
+-- name: DeleteExpiredRevokedAccessTokens :exec
+DELETE FROM revoked_access_tokens WHERE expires_at <= $1;
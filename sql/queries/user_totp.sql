@@ -0,0 +1,22 @@
+-- name: UpsertUserTOTP :one
+INSERT INTO user_totp (user_id, created_at, updated_at, secret)
+VALUES ($1,
+        NOW(),
+        NOW(),
+        $2)
+ON CONFLICT (user_id) DO UPDATE SET updated_at = NOW(), secret = EXCLUDED.secret, last_used_step = 0
+WHERE user_totp.confirmed_at IS NULL
+RETURNING *;
+
+-- name: GetUserTOTP :one
+SELECT * FROM user_totp WHERE user_id = $1;
+
+-- name: ConfirmUserTOTP :one
+UPDATE user_totp SET updated_at = NOW(), confirmed_at = NOW(), last_used_step = $2 WHERE user_id = $1 AND confirmed_at IS NULL
+RETURNING *;
+
+-- name: UseUserTOTPStep :execrows
+UPDATE user_totp SET updated_at = NOW(), last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2;
+
+-- name: DeleteUserTOTP :exec
+DELETE FROM user_totp WHERE user_id = $1;
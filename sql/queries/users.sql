@@ -1,11 +1,12 @@
 -- name: CreateUser :one
-INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+INSERT INTO users (id, created_at, updated_at, email, hashed_password, handle)
 VALUES (
   gen_random_uuid(),
   NOW(),
   NOW(),
   $1,
-  $2
+  $2,
+  $3
 )
 RETURNING *;
 
@@ -22,3 +23,45 @@ RETURNING *;
 -- name: UpdateUserIsChirpyRed :one
 UPDATE users SET updated_at = NOW(), is_chirpy_red = $2 WHERE id = $1
 RETURNING *;
+
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users WHERE LOWER(handle) = LOWER(sqlc.arg(handle)::text);
+
+-- name: UpdateUserProfile :one
+UPDATE users SET updated_at = NOW(), handle = $2, display_name = $3, bio = $4, location = $5, website = $6 WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserPassword :one
+UPDATE users SET updated_at = NOW(), hashed_password = $2 WHERE id = $1
+RETURNING *;
+
+-- name: VerifyUserEmail :one
+UPDATE users SET updated_at = NOW(), email_verified_at = NOW() WHERE id = $1 AND email = $2
+RETURNING *;
+
+-- name: ClaimVerificationEmail :execrows
+UPDATE users SET verification_sent_at = NOW()
+WHERE id = $1 AND email_verified_at IS NULL
+  AND (verification_sent_at IS NULL OR verification_sent_at < sqlc.arg(sent_before)::timestamp);
+
+-- name: UpdateUserRole :one
+UPDATE users SET updated_at = NOW(), role = $2 WHERE id = $1
+RETURNING *;
+
+-- name: RequestUserDeletion :one
+UPDATE users SET updated_at = NOW(), deletion_requested_at = NOW() WHERE id = $1
+RETURNING *;
+
+-- name: CancelUserDeletion :one
+UPDATE users SET updated_at = NOW(), deletion_requested_at = NULL WHERE id = $1
+RETURNING *;
+
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users WHERE deletion_requested_at < sqlc.arg(requested_before)::timestamp;
+
+-- name: UpdateUserEmail :one
+UPDATE users SET updated_at = NOW(), email = $2, email_verified_at = NOW() WHERE id = $1
+RETURNING *;
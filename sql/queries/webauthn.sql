@@ -0,0 +1,45 @@
+-- name: CreateWebAuthnCredential :one
+INSERT INTO webauthn_credentials (id, created_at, updated_at, user_id, credential_id, public_key, sign_count, name)
+VALUES (gen_random_uuid(),
+        NOW(),
+        NOW(),
+        $1,
+        $2,
+        $3,
+        $4,
+        $5)
+RETURNING *;
+
+-- name: GetWebAuthnCredentialByCredentialID :one
+SELECT * FROM webauthn_credentials WHERE credential_id = $1;
+
+-- name: GetWebAuthnCredentialsByUserID :many
+SELECT * FROM webauthn_credentials WHERE user_id = $1
+ORDER BY created_at;
+
+-- name: UpdateWebAuthnCredentialSignCount :exec
+UPDATE webauthn_credentials SET updated_at = NOW(), last_used_at = NOW(), sign_count = $2 WHERE id = $1;
+
+-- name: DeleteWebAuthnCredential :execrows
+DELETE FROM webauthn_credentials WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteWebAuthnCredentialsByUserID :exec
+DELETE FROM webauthn_credentials WHERE user_id = $1;
+
+-- name: CreateWebAuthnChallenge :one
+INSERT INTO webauthn_challenges (id, created_at, user_id, ceremony, challenge, expires_at)
+VALUES (gen_random_uuid(),
+        NOW(),
+        $1,
+        $2,
+        $3,
+        $4)
+RETURNING *;
+
+-- name: ConsumeWebAuthnChallenge :one
+DELETE FROM webauthn_challenges
+WHERE id = $1 AND ceremony = $2 AND expires_at > NOW()
+RETURNING *;
+
+-- name: DeleteExpiredWebAuthnChallenges :exec
+DELETE FROM webauthn_challenges WHERE expires_at < $1;
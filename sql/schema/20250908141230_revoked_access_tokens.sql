@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE revoked_access_tokens (
+    jti        TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id    UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL
+);
+CREATE INDEX revoked_access_tokens_created_at_idx ON revoked_access_tokens (created_at);
+CREATE INDEX revoked_access_tokens_expires_at_idx ON revoked_access_tokens (expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE revoked_access_tokens;
+-- +goose StatementEnd
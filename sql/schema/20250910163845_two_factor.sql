@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE user_totp (
+    user_id        UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    created_at     TIMESTAMP NOT NULL,
+    updated_at     TIMESTAMP NOT NULL,
+    secret         TEXT      NOT NULL,
+    confirmed_at   TIMESTAMP,
+    last_used_step BIGINT    NOT NULL DEFAULT 0
+);
+CREATE TABLE recovery_codes (
+    id         UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id    UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash  TEXT      NOT NULL,
+    used_at    TIMESTAMP
+);
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE recovery_codes;
+DROP TABLE user_totp;
+-- +goose StatementEnd
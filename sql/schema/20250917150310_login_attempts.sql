@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE login_attempts (
+    throttle_key   TEXT PRIMARY KEY,
+    failures       INTEGER   NOT NULL,
+    last_failed_at TIMESTAMP NOT NULL,
+    blocked_until  TIMESTAMP NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE login_attempts;
+-- +goose StatementEnd
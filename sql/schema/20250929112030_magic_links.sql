@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE magic_links (
+    id          UUID PRIMARY KEY,
+    created_at  TIMESTAMP NOT NULL,
+    user_id     UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    nonce_hash  TEXT      NOT NULL,
+    use_cookies BOOLEAN   NOT NULL DEFAULT FALSE,
+    expires_at  TIMESTAMP NOT NULL,
+    used_at     TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE magic_links;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+UPDATE refresh_tokens
+SET token       = encode(sha256(convert_to(token, 'UTF8')), 'hex'),
+    replaced_by = encode(sha256(convert_to(replaced_by, 'UTF8')), 'hex');
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- The hashes cannot be turned back into tokens, so everyone has to log in again.
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
+-- +goose StatementEnd
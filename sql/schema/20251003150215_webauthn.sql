@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE webauthn_credentials (
+    id            UUID PRIMARY KEY,
+    created_at    TIMESTAMP NOT NULL,
+    updated_at    TIMESTAMP NOT NULL,
+    user_id       UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    credential_id BYTEA     NOT NULL UNIQUE,
+    public_key    BYTEA     NOT NULL,
+    sign_count    BIGINT    NOT NULL DEFAULT 0,
+    name          TEXT      NOT NULL,
+    last_used_at  TIMESTAMP
+);
+CREATE INDEX webauthn_credentials_user_id_idx ON webauthn_credentials (user_id);
+
+CREATE TABLE webauthn_challenges (
+    id         UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id    UUID REFERENCES users (id) ON DELETE CASCADE,
+    ceremony   TEXT      NOT NULL,
+    challenge  BYTEA     NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE webauthn_challenges;
+DROP TABLE webauthn_credentials;
+-- +goose StatementEnd
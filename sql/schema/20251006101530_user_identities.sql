@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE user_identities (
+    id         UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id    UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    provider   TEXT      NOT NULL,
+    subject    TEXT      NOT NULL,
+    email      TEXT      NOT NULL,
+    UNIQUE (provider, subject)
+);
+CREATE INDEX user_identities_user_id_idx ON user_identities (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE user_identities;
+-- +goose StatementEnd
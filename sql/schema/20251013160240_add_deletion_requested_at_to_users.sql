@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN deletion_requested_at TIMESTAMP;
+CREATE INDEX users_deletion_requested_at_idx ON users (deletion_requested_at) WHERE deletion_requested_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX users_deletion_requested_at_idx;
+ALTER TABLE users DROP COLUMN deletion_requested_at;
+-- +goose StatementEnd
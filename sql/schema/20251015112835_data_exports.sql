@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE data_exports (
+    id           UUID PRIMARY KEY,
+    created_at   TIMESTAMP NOT NULL,
+    updated_at   TIMESTAMP NOT NULL,
+    user_id      UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    status       TEXT      NOT NULL DEFAULT 'pending',
+    archive      BYTEA,
+    completed_at TIMESTAMP,
+    expires_at   TIMESTAMP
+);
+CREATE INDEX data_exports_user_id_idx ON data_exports (user_id);
+CREATE INDEX data_exports_status_idx ON data_exports (status) WHERE status IN ('pending', 'running');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE data_exports;
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE email_changes (
+    id           UUID PRIMARY KEY,
+    created_at   TIMESTAMP NOT NULL,
+    user_id      UUID      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    old_email    TEXT      NOT NULL,
+    new_email    TEXT      NOT NULL,
+    confirmed_at TIMESTAMP,
+    reverted_at  TIMESTAMP
+);
+CREATE INDEX email_changes_user_id_idx ON email_changes (user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE email_changes;
+-- +goose StatementEnd
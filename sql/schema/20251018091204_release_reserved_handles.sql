@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- "verify" was reserved after some users had claimed it, and their profiles
+-- are shadowed by GET /api/users/verify. The handle is released and the
+-- users are told to choose a new one; released_handles is the queue of
+-- notices still to send.
+CREATE TABLE released_handles (
+    user_id     UUID PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+    handle      TEXT      NOT NULL,
+    released_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO released_handles (user_id, handle, released_at)
+SELECT id, handle, NOW() FROM users WHERE LOWER(handle) = 'verify';
+
+UPDATE users SET handle = NULL, updated_at = NOW()
+WHERE LOWER(handle) = 'verify';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Released handles are not given back.
+DROP TABLE released_handles;
+-- +goose StatementEnd
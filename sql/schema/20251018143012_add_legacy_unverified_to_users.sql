@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN legacy_unverified BOOLEAN NOT NULL DEFAULT FALSE;
+-- Every signup since email verification was added claims a verification
+-- email, so accounts that never got one are older than that. They may keep
+-- chirping with REQUIRE_VERIFIED_EMAIL, without being trusted as verified.
+UPDATE users SET legacy_unverified = TRUE
+WHERE email_verified_at IS NULL AND verification_sent_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN legacy_unverified;
+-- +goose StatementEnd
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/account"
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/oidc"
+	"context"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Single sign-on logs users in through external OpenID Connect providers.
+// The state, nonce and PKCE verifier of a login attempt travel in a signed
+// cookie, which also binds the callback to the browser that started it.
+const (
+	ssoStatePurpose  = "sso-state"
+	ssoStateCookie   = "chirpy_sso_state"
+	ssoStateDuration = 10 * time.Minute
+)
+
+var (
+	errSSOStateMismatch   = errors.New("sso state does not match")
+	errSSOEmailUnverified = errors.New("provider did not supply a verified email")
+)
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// loadOIDCProviders reads the providers named in OIDC_PROVIDERS, a comma
+// separated list. A provider "corp" is configured with OIDC_CORP_ISSUER,
+// OIDC_CORP_CLIENT_ID, OIDC_CORP_CLIENT_SECRET and optionally
+// OIDC_CORP_SCOPES (default "email").
+func loadOIDCProviders(baseURL string) (map[string]*oidc.Provider, error) {
+	providers := map[string]*oidc.Provider{}
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !providerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid OIDC provider name %q", name)
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		config := oidc.Config{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  baseURL + "/api/sso/" + name + "/callback",
+			Scopes:       []string{"email"},
+		}
+		if config.Issuer == "" || config.ClientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID must be set", prefix, prefix)
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			config.Scopes = auth.ParseScope(scopes)
+		}
+
+		providers[name] = oidc.NewProvider(config, client)
+	}
+
+	return providers, nil
+}
+
+type ssoState struct {
+	Provider   string `json:"provider"`
+	State      string `json:"state"`
+	Nonce      string `json:"nonce"`
+	Verifier   string `json:"verifier"`
+	UseCookies bool   `json:"use_cookies"`
+}
+
+func (cfg *apiConfig) indexSSOProviders(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type provider struct {
+		Name     string `json:"name"`
+		LoginURL string `json:"login_url"`
+	}
+
+	resp := []provider{}
+	for name := range cfg.ssoProviders {
+		resp = append(resp, provider{name, cfg.baseURL + "/api/sso/" + name + "/login"})
+	}
+	sort.Slice(resp, func(i, j int) bool { return resp[i].Name < resp[j].Name })
+
+	writeSuccessJson(w, resp)
+}
+
+// startSSOLogin redirects the browser to the provider's login page.
+// ?use_cookies=true makes the callback start a cookie session, which only
+// a navigation from Chirpy itself may ask for.
+func (cfg *apiConfig) startSSOLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	provider, ok := cfg.ssoProviders[r.PathValue("provider")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, errors.New("unknown sso provider"), "Unknown provider")
+		return
+	}
+
+	state := ssoState{Provider: provider.Name(), UseCookies: r.URL.Query().Get("use_cookies") == "true"}
+	if state.UseCookies {
+		err := checkCookieNavigation(r)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			writeErrorJson(w, err, "Start the login from Chirpy")
+			return
+		}
+	}
+
+	for _, value := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		token, err := auth.MakeRefreshToken()
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+		*value = token
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state.State, state.Nonce, auth.PKCEChallenge(state.Verifier))
+	if err != nil {
+		w.WriteHeader(http.StatusBadGateway)
+		writeErrorJson(w, err, "Provider is unavailable")
+		return
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	// Lax, since the provider sends the browser back with a top-level
+	// cross-site navigation.
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoStateCookie,
+		Value:    auth.MakeSignedToken(cfg.secret, ssoStatePurpose, string(data), ssoStateDuration),
+		Path:     "/api/sso",
+		MaxAge:   int(ssoStateDuration.Seconds()),
+		HttpOnly: true,
+		Secure:   cfg.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// finishSSOLogin handles the provider redirecting back and logs the user
+// in like createSession.
+func (cfg *apiConfig) finishSSOLogin(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	provider, ok := cfg.ssoProviders[r.PathValue("provider")]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, errors.New("unknown sso provider"), "Unknown provider")
+		return
+	}
+
+	state, err := cfg.ssoStateFromRequest(r, provider.Name())
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoStateCookie,
+		Path:     "/api/sso",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   cfg.secureCookies,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, err, "Login expired or was started in another browser")
+		return
+	}
+
+	query := r.URL.Query()
+	if query.Get("error") != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, fmt.Errorf("provider returned %s: %s", query.Get("error"), query.Get("error_description")), "Login was cancelled or denied")
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(r.Context(), query.Get("code"), state.Verifier)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, err, "Couldn't complete login")
+		return
+	}
+
+	idToken, err := provider.VerifyIDToken(r.Context(), rawIDToken, state.Nonce)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, err, "Couldn't complete login")
+		return
+	}
+
+	user, err := cfg.ssoUser(r.Context(), provider.Name(), idToken)
+	if errors.Is(err, errSSOEmailUnverified) {
+		w.WriteHeader(http.StatusForbidden)
+		writeErrorJson(w, err, "Your account at the provider has no verified email")
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	cfg.completeLogin(w, r, user, state.UseCookies)
+}
+
+// ssoStateFromRequest returns the login attempt in the state cookie after
+// checking it belongs to provider and matches the state parameter.
+func (cfg *apiConfig) ssoStateFromRequest(r *http.Request, provider string) (ssoState, error) {
+	cookie, err := r.Cookie(ssoStateCookie)
+	if err != nil {
+		return ssoState{}, errSSOStateMismatch
+	}
+
+	data, err := auth.VerifySignedToken(cfg.secret, ssoStatePurpose, cookie.Value)
+	if err != nil {
+		return ssoState{}, err
+	}
+
+	var state ssoState
+	err = json.Unmarshal([]byte(data), &state)
+	if err != nil {
+		return ssoState{}, err
+	}
+
+	if state.Provider != provider || subtle.ConstantTimeCompare([]byte(state.State), []byte(r.URL.Query().Get("state"))) != 1 {
+		return ssoState{}, errSSOStateMismatch
+	}
+	return state, nil
+}
+
+// ssoUser returns the user linked to the external identity, linking it on
+// first login to the user with the same email or to a new user. Only
+// emails the provider has verified are trusted for this.
+func (cfg *apiConfig) ssoUser(ctx context.Context, provider string, idToken oidc.IDToken) (database.User, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	q := cfg.sql.WithTx(tx)
+
+	identity, err := q.GetUserIdentity(ctx, database.GetUserIdentityParams{Provider: provider, Subject: idToken.Subject})
+	if err == nil {
+		return q.GetUserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, err
+	}
+
+	email := strings.TrimSpace(idToken.Email)
+	if !idToken.EmailVerified || !account.ValidEmail(email) {
+		return database.User{}, errSSOEmailUnverified
+	}
+
+	var familyIDs []uuid.UUID
+	user, err := q.GetUserByEmail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Users created here have no password; they can set one through
+		// the password reset flow.
+		user, err = q.CreateUser(ctx, database.CreateUserParams{Email: email})
+	} else if err == nil && !user.EmailVerifiedAt.Valid {
+		// Whoever registered the unverified account may not own the
+		// address, so every way they had to sign in stops working.
+		familyIDs, err = revokeAllCredentials(ctx, q, user.ID)
+		if err == nil {
+			err = removeSignInMethods(ctx, q, user.ID)
+		}
+		if err == nil {
+			_, err = q.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{ID: user.ID})
+		}
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if !user.EmailVerifiedAt.Valid {
+		user, err = q.VerifyUserEmail(ctx, database.VerifyUserEmailParams{ID: user.ID, Email: user.Email})
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+
+	_, err = q.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  idToken.Subject,
+		Email:    email,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return database.User{}, err
+	}
+
+	for _, familyID := range familyIDs {
+		err = cfg.revokeSessionAccessTokens(ctx, user.ID, familyID)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+	return user, nil
+}
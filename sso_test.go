@@ -0,0 +1,89 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/oidc"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestSSOTakesOverUnverifiedAccount(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	ctx := context.Background()
+
+	// Someone registered the address without owning it.
+	squatter := createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+	pat := createTestPAT(t, cfg, session.Token, auth.ScopeChirpsRead)
+	_, err := cfg.sql.CreateUserIdentity(ctx, database.CreateUserIdentityParams{
+		UserID:   squatter.ID,
+		Provider: "other",
+		Subject:  "squatter",
+		Email:    "alice@example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := cfg.ssoUser(ctx, "example", oidc.IDToken{Subject: "alice", Email: "alice@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != squatter.ID || !user.EmailVerifiedAt.Valid {
+		t.Fatalf("ssoUser() = %+v, want the verified account %s", user, squatter.ID)
+	}
+
+	for name, token := range map[string]string{"access token": session.Token, "personal access token": pat} {
+		_, err := cfg.authenticate(withBearer(newJSONRequest(http.MethodGet, "/api/chirps", nil), token))
+		if err == nil {
+			t.Errorf("%s of the previous owner still authenticates", name)
+		}
+	}
+	if _, status := refresh(cfg, session.RefreshToken); status != http.StatusUnauthorized {
+		t.Errorf("refresh token of the previous owner: status %d, want %d", status, http.StatusUnauthorized)
+	}
+
+	rr := serve(cfg.createSession, newJSONRequest(http.MethodPost, "/api/login", map[string]any{
+		"email":    "alice@example.com",
+		"password": testPassword,
+	}))
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("password of the previous owner: status %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+
+	_, err = cfg.sql.GetUserIdentity(ctx, database.GetUserIdentityParams{Provider: "other", Subject: "squatter"})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("identity linked by the previous owner: error = %v, want %v", err, sql.ErrNoRows)
+	}
+	_, err = cfg.sql.GetUserIdentity(ctx, database.GetUserIdentityParams{Provider: "example", Subject: "alice"})
+	if err != nil {
+		t.Errorf("new identity: %s", err)
+	}
+}
+
+func TestSSOKeepsVerifiedAccount(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	ctx := context.Background()
+
+	owner := createTestUser(t, cfg, "alice@example.com")
+	_, err := cfg.sql.VerifyUserEmail(ctx, database.VerifyUserEmailParams{ID: owner.ID, Email: owner.Email})
+	if err != nil {
+		t.Fatal(err)
+	}
+	session := loginTestUser(t, cfg, "alice@example.com")
+
+	_, err = cfg.ssoUser(ctx, "example", oidc.IDToken{Subject: "alice", Email: "alice@example.com", EmailVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = cfg.authenticate(withBearer(newJSONRequest(http.MethodGet, "/api/chirps", nil), session.Token))
+	if err != nil {
+		t.Errorf("session of the verified owner: %s", err)
+	}
+	loginTestUser(t, cfg, "alice@example.com")
+}
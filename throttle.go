@@ -0,0 +1,197 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/throttle"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadLoginPolicy applies LOGIN_LOCKOUT_THRESHOLD and LOGIN_LOCKOUT_DURATION
+// to throttle.DefaultPolicy.
+func loadLoginPolicy() (throttle.Policy, error) {
+	policy := throttle.DefaultPolicy
+
+	if value := os.Getenv("LOGIN_LOCKOUT_THRESHOLD"); value != "" {
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 1 {
+			return policy, fmt.Errorf("invalid LOGIN_LOCKOUT_THRESHOLD: %q", value)
+		}
+		policy.Threshold = threshold
+	}
+
+	if value := os.Getenv("LOGIN_LOCKOUT_DURATION"); value != "" {
+		lockout, err := time.ParseDuration(value)
+		if err != nil || lockout <= 0 {
+			return policy, fmt.Errorf("invalid LOGIN_LOCKOUT_DURATION: %q", value)
+		}
+		policy.Lockout = lockout
+	}
+
+	return policy, nil
+}
+
+func emailThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// recordLoginAttempt counts an attempt against every key before it is
+// checked, blocking each key for as long as the login policy asks for. Each
+// key is checked and counted in a single statement, so parallel guesses
+// cannot all get in before the block. When a key is still blocked nothing
+// is counted and the wait is returned instead. Once the attempt succeeds,
+// the caller clears the account's key with clearLoginFailures and takes the
+// attempt back from the others with refundLoginAttempt.
+func (cfg *apiConfig) recordLoginAttempt(ctx context.Context, keys ...string) (time.Duration, error) {
+	delays := cfg.loginDelays()
+	resetBefore := time.Now().Add(-cfg.loginPolicy.ResetAfter)
+	for i, key := range keys {
+		attempt, err := cfg.sql.RecordLoginAttempt(ctx, database.RecordLoginAttemptParams{
+			ThrottleKey: key,
+			Delays:      delays,
+			ResetBefore: resetBefore,
+		})
+		if err != nil {
+			cfg.refundLoginAttempt(ctx, keys[:i]...)
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			return cfg.loginRetryAfter(ctx, key)
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		failures := int(attempt.Failures)
+		if cfg.loginPolicy.Locked(failures) {
+			log.Printf("Locking out %s after %d attempts", key, failures)
+		}
+	}
+	return 0, nil
+}
+
+// loginRetryAfter returns how long the caller has to wait before another
+// attempt for the blocked key is allowed.
+func (cfg *apiConfig) loginRetryAfter(ctx context.Context, key string) (time.Duration, error) {
+	attempts, err := cfg.sql.GetLoginAttempts(ctx, []string{key})
+	if err != nil {
+		return 0, err
+	}
+
+	// The block may have run out since the attempt was turned away.
+	wait := time.Second
+	for _, attempt := range attempts {
+		wait = max(wait, time.Until(attempt.BlockedUntil))
+	}
+	return wait, nil
+}
+
+// refundLoginAttempt takes back an attempt counted by recordLoginAttempt,
+// along with the delay it added.
+func (cfg *apiConfig) refundLoginAttempt(ctx context.Context, keys ...string) {
+	delays := cfg.loginDelays()
+	for _, key := range keys {
+		err := cfg.sql.RefundLoginAttempt(ctx, database.RefundLoginAttemptParams{
+			Delays:      delays,
+			ThrottleKey: key,
+		})
+		if err != nil {
+			log.Printf("Error refunding login attempt: %s", err)
+		}
+	}
+}
+
+// loginDelays returns the delays of the login policy in seconds, for the
+// database to apply.
+func (cfg *apiConfig) loginDelays() []float64 {
+	policyDelays := cfg.loginPolicy.Delays()
+	delays := make([]float64, 0, len(policyDelays))
+	for _, delay := range policyDelays {
+		delays = append(delays, delay.Seconds())
+	}
+	return delays
+}
+
+// clearLoginFailures forgets the failures counted against key after a
+// successful login.
+func (cfg *apiConfig) clearLoginFailures(ctx context.Context, key string) {
+	_, err := cfg.sql.DeleteLoginAttempts(ctx, key)
+	if err != nil {
+		log.Printf("Error clearing login failures: %s", err)
+	}
+}
+
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+	w.WriteHeader(http.StatusTooManyRequests)
+	writeErrorJson(w, errors.New("login throttled"), "Too many failed attempts, try again later")
+}
+
+// confirmPassword checks the password a user enters again before a
+// sensitive change, throttled like a login to their account. When it
+// returns false it has already responded.
+func (cfg *apiConfig) confirmPassword(w http.ResponseWriter, r *http.Request, user database.User, password string) bool {
+	throttleKey := emailThrottleKey(user.Email)
+	retryAfter, err := cfg.recordLoginAttempt(r.Context(), throttleKey)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return false
+	}
+	if retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter)
+		return false
+	}
+
+	_, err = cfg.passwords.Verify(password, user.HashedPassword)
+	if err != nil {
+		w.WriteHeader(http.StatusForbidden)
+		writeErrorJson(w, err, "Password is incorrect")
+		return false
+	}
+
+	cfg.clearLoginFailures(r.Context(), throttleKey)
+	return true
+}
+
+func (cfg *apiConfig) pruneLoginAttempts(ctx context.Context) error {
+	return cfg.sql.DeleteStaleLoginAttempts(ctx, time.Now().Add(-cfg.loginPolicy.ResetAfter))
+}
+
+// clearLockout lets an admin lift the lockout of an account (?email=) or
+// a client address (?ip=).
+func (cfg *apiConfig) clearLockout(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	var keys []string
+	if email := r.URL.Query().Get("email"); email != "" {
+		keys = append(keys, emailThrottleKey(email))
+	}
+	if ip := r.URL.Query().Get("ip"); ip != "" {
+		keys = append(keys, ipThrottleKey(ip))
+	}
+	if len(keys) == 0 {
+		writeErrorJson(w, errors.New("no lockout given"), "Pass an email or ip to clear")
+		return
+	}
+
+	for _, key := range keys {
+		_, err := cfg.sql.DeleteLoginAttempts(r.Context(), key)
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+	}
+
+	writeSuccessJson(w, nil, http.StatusNoContent)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestLoginThrottleHoldsUnderParallelGuesses(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+
+	const guesses = 20
+	statuses := make(chan int, guesses)
+	var wg sync.WaitGroup
+	for range guesses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := serve(cfg.createSession, newJSONRequest(http.MethodPost, "/api/login", map[string]any{
+				"email":    "alice@example.com",
+				"password": "wrong password",
+			}))
+			statuses <- rr.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+
+	// Only the attempts the policy allows before its first delay get to
+	// check the password; every other one is turned away.
+	allowed := cfg.loginPolicy.FreeAttempts + 1
+	if counts[http.StatusUnauthorized] != allowed || counts[http.StatusTooManyRequests] != guesses-allowed {
+		t.Errorf("statuses = %v, want %d x %d and %d x %d", counts,
+			allowed, http.StatusUnauthorized, guesses-allowed, http.StatusTooManyRequests)
+	}
+}
+
+func TestSuccessfulLoginsDoNotCountAgainstClient(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+	createTestUser(t, cfg, "bob@example.com")
+
+	for range cfg.loginPolicy.Threshold + 1 {
+		loginTestUser(t, cfg, "alice@example.com")
+	}
+
+	// A wrong password now only costs the free attempts of a fresh client.
+	rr := serve(cfg.createSession, newJSONRequest(http.MethodPost, "/api/login", map[string]any{
+		"email":    "bob@example.com",
+		"password": "wrong password",
+	}))
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status %d, want %d", rr.Code, http.StatusUnauthorized)
+	}
+	loginTestUser(t, cfg, "bob@example.com")
+}
+
+func TestThrottleBlocksAfterFailures(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+
+	login := func(password string) int {
+		return serve(cfg.createSession, newJSONRequest(http.MethodPost, "/api/login", map[string]any{
+			"email":    "alice@example.com",
+			"password": password,
+		})).Code
+	}
+
+	for i := range cfg.loginPolicy.FreeAttempts + 1 {
+		if status := login("wrong password"); status != http.StatusUnauthorized {
+			t.Fatalf("guess %d: status %d, want %d", i+1, status, http.StatusUnauthorized)
+		}
+	}
+
+	// Even the right password has to wait for the delay.
+	if status := login(testPassword); status != http.StatusTooManyRequests {
+		t.Fatalf("login during the delay: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+}
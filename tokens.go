@@ -0,0 +1,163 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type personalAccessTokenResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func newPersonalAccessTokenResponse(pat database.PersonalAccessToken) personalAccessTokenResponse {
+	resp := personalAccessTokenResponse{
+		ID:        pat.ID,
+		CreatedAt: pat.CreatedAt,
+		Name:      pat.Name,
+		Scopes:    pat.Scopes,
+	}
+	if pat.ExpiresAt.Valid {
+		resp.ExpiresAt = &pat.ExpiresAt.Time
+	}
+	if pat.LastUsedAt.Valid {
+		resp.LastUsedAt = &pat.LastUsedAt.Time
+	}
+	return resp
+}
+
+func (cfg *apiConfig) createPersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	name := strings.TrimSpace(params.Name)
+	if name == "" || len(name) > 100 {
+		writeErrorJson(w, errors.New("invalid token name"), "Name must be between 1 and 100 characters")
+		return
+	}
+
+	if len(params.Scopes) == 0 || !auth.ValidScopes(params.Scopes) {
+		writeErrorJson(w, errors.New("invalid scopes"), "Scopes must be one or more of: "+strings.Join(auth.Scopes, ", "))
+		return
+	}
+
+	var expiresAt sql.NullTime
+	if params.ExpiresAt != nil {
+		if !params.ExpiresAt.After(time.Now()) {
+			writeErrorJson(w, errors.New("expiry in the past"), "Expiry must be in the future")
+			return
+		}
+		expiresAt = sql.NullTime{Time: *params.ExpiresAt, Valid: true}
+	}
+
+	token, err := auth.MakePersonalAccessToken()
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	pat, err := cfg.sql.CreatePersonalAccessToken(r.Context(), database.CreatePersonalAccessTokenParams{
+		UserID:    caller.UserID,
+		Name:      name,
+		TokenHash: auth.HashToken(token),
+		Scopes:    params.Scopes,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	// The token itself is only ever shown in this response.
+	resp := newPersonalAccessTokenResponse(pat)
+	resp.Token = token
+
+	writeSuccessJson(w, resp, http.StatusCreated)
+}
+
+func (cfg *apiConfig) indexPersonalAccessTokens(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	pats, err := cfg.sql.GetPersonalAccessTokensByUserID(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	resp := []personalAccessTokenResponse{}
+	for _, pat := range pats {
+		resp = append(resp, newPersonalAccessTokenResponse(pat))
+	}
+
+	writeSuccessJson(w, resp)
+}
+
+func (cfg *apiConfig) deletePersonalAccessToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	tokenID, err := uuid.Parse(r.PathValue("tokenID"))
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	rows, err := cfg.sql.RevokePersonalAccessToken(r.Context(), database.RevokePersonalAccessTokenParams{
+		ID:     tokenID,
+		UserID: caller.UserID,
+	})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if rows == 0 {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, errors.New("token not found"), "Something went wrong")
+		return
+	}
+
+	writeSuccessJson(w, nil, http.StatusNoContent)
+}
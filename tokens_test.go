@@ -0,0 +1,69 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"net/http"
+	"testing"
+)
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+	reader := createTestPAT(t, cfg, session.Token, auth.ScopeChirpsRead)
+	profileWriter := createTestPAT(t, cfg, session.Token, auth.ScopeProfileWrite)
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		request *http.Request
+		want    int
+	}{
+		{
+			name:    "chirp without chirps:write",
+			handler: cfg.createChirp,
+			request: withBearer(newJSONRequest(http.MethodPost, "/api/chirps", map[string]any{"body": "Hello"}), reader),
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "email change with profile:write",
+			handler: cfg.updateUser,
+			request: withBearer(newJSONRequest(http.MethodPut, "/api/users", map[string]any{
+				"email":            "mallory@example.com",
+				"password":         "taken over",
+				"current_password": testPassword,
+			}), profileWriter),
+			want: http.StatusForbidden,
+		},
+		{
+			name:    "new token from a token",
+			handler: cfg.createPersonalAccessToken,
+			request: withBearer(newJSONRequest(http.MethodPost, "/api/tokens", map[string]any{
+				"name":   "copy",
+				"scopes": []string{auth.ScopeChirpsWrite},
+			}), profileWriter),
+			want: http.StatusForbidden,
+		},
+		{
+			name:    "token list with a token",
+			handler: cfg.indexPersonalAccessTokens,
+			request: withBearer(newJSONRequest(http.MethodGet, "/api/tokens", nil), reader),
+			want:    http.StatusForbidden,
+		},
+		{
+			name:    "token list with the session",
+			handler: cfg.indexPersonalAccessTokens,
+			request: withBearer(newJSONRequest(http.MethodGet, "/api/tokens", nil), session.Token),
+			want:    http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serve(tt.handler, tt.request)
+			if rr.Code != tt.want {
+				t.Errorf("status %d, want %d, body %s", rr.Code, tt.want, rr.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const recoveryCodeCount = 10
+
+func (cfg *apiConfig) enrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	user, err := cfg.sql.GetUserByID(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+
+	secret, err := auth.MakeTOTPSecret()
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	_, err = cfg.sql.UpsertUserTOTP(r.Context(), database.UpsertUserTOTPParams{
+		UserID: user.ID,
+		Secret: secret,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		w.WriteHeader(http.StatusConflict)
+		writeErrorJson(w, err, "Two-factor authentication is already enabled")
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	type response struct {
+		Secret          string `json:"secret"`
+		ProvisioningURI string `json:"provisioning_uri"`
+	}
+	resp := response{secret, auth.TOTPProvisioningURI("Chirpy", user.Email, secret)}
+
+	writeSuccessJson(w, resp, http.StatusCreated)
+}
+
+func (cfg *apiConfig) confirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Code string `json:"code"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	totp, err := cfg.sql.GetUserTOTP(r.Context(), caller.UserID)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		writeErrorJson(w, err, "Two-factor enrollment not started")
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		w.WriteHeader(http.StatusConflict)
+		writeErrorJson(w, errors.New("totp already confirmed"), "Two-factor authentication is already enabled")
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, params.Code, time.Now())
+	if !ok {
+		writeErrorJson(w, errors.New("invalid totp code"), "Invalid code")
+		return
+	}
+
+	codes, err := cfg.confirmTOTP(r.Context(), totp.UserID, step)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	type response struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	resp := response{codes}
+
+	writeSuccessJson(w, resp)
+}
+
+// confirmTOTP enables the pending TOTP enrollment and replaces the user's
+// recovery codes, returning the new codes in plain text.
+func (cfg *apiConfig) confirmTOTP(ctx context.Context, userID uuid.UUID, step int64) ([]string, error) {
+	codes, err := auth.MakeRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	q := cfg.sql.WithTx(tx)
+
+	_, err = q.ConfirmUserTOTP(ctx, database.ConfirmUserTOTPParams{UserID: userID, LastUsedStep: step})
+	if err != nil {
+		return nil, err
+	}
+
+	err = q.DeleteRecoveryCodesByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, code := range codes {
+		err = q.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{UserID: userID, CodeHash: auth.HashToken(code)})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return codes, tx.Commit()
+}
+
+func (cfg *apiConfig) disableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorizeSession(r)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	type parameters struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	var params parameters
+	err = json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	err = cfg.checkSecondFactor(r.Context(), caller.UserID, params.Code, params.RecoveryCode)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, err, "Invalid code")
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	defer tx.Rollback()
+
+	q := cfg.sql.WithTx(tx)
+
+	err = q.DeleteUserTOTP(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	err = q.DeleteRecoveryCodesByUserID(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	writeSuccessJson(w, nil, http.StatusNoContent)
+}
+
+func (cfg *apiConfig) verifyTwoFactorSession(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	type parameters struct {
+		ChallengeToken string `json:"challenge_token"`
+		Code           string `json:"code"`
+		RecoveryCode   string `json:"recovery_code"`
+		UseCookies     bool   `json:"use_cookies"`
+	}
+
+	var params parameters
+	err := json.NewDecoder(r.Body).Decode(&params)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	claims, err := auth.ParseJWT(params.ChallengeToken, cfg.keys, cfg.challengeOpts)
+	if err != nil || cfg.denylist.IsRevoked(claims.ID) {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, errors.Join(err, errors.New("invalid challenge token")), "Something went wrong")
+		return
+	}
+
+	// Six digit codes are throttled like passwords so they cannot be guessed
+	// within the lifetime of a challenge token.
+	throttleKey := "2fa:" + claims.UserID().String()
+	retryAfter, err := cfg.recordLoginAttempt(r.Context(), throttleKey)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter)
+		return
+	}
+
+	err = cfg.checkSecondFactor(r.Context(), claims.UserID(), params.Code, params.RecoveryCode)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		writeErrorJson(w, err, "Invalid code")
+		return
+	}
+
+	cfg.clearLoginFailures(r.Context(), throttleKey)
+
+	// Challenge tokens are single use.
+	err = cfg.denylist.Revoke(r.Context(), claims.ID, claims.UserID(), claims.ExpiresAt.Time)
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+
+	user, err := cfg.sql.GetUserByID(r.Context(), claims.UserID())
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+
+	cfg.writeSession(w, r, user, params.UseCookies)
+}
+
+// checkSecondFactor accepts either a current TOTP code that has not been
+// used before or an unused recovery code, which is then spent.
+func (cfg *apiConfig) checkSecondFactor(ctx context.Context, userID uuid.UUID, code, recoveryCode string) error {
+	if recoveryCode != "" {
+		rows, err := cfg.sql.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+			UserID:   userID,
+			CodeHash: auth.HashToken(strings.ToLower(strings.TrimSpace(recoveryCode))),
+		})
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return errors.New("invalid recovery code")
+		}
+		return nil
+	}
+
+	totp, err := cfg.sql.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !totp.ConfirmedAt.Valid {
+		return errors.New("totp not confirmed")
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return errors.New("invalid totp code")
+	}
+
+	rows, err := cfg.sql.UseUserTOTPStep(ctx, database.UseUserTOTPStepParams{UserID: userID, LastUsedStep: step})
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return errors.New("totp code already used")
+	}
+	return nil
+}
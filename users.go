@@ -1,10 +1,16 @@
 package main
 
 import (
+	"codingiam/chirpy/internal/account"
 	"codingiam/chirpy/internal/auth"
 	"codingiam/chirpy/internal/database"
+	"context"
+	"database/sql"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
+	"mime"
 	"net/http"
 	"strings"
 	"time"
@@ -18,6 +24,8 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 	type parameters struct {
 		Password string `json:"password"`
 		Email    string `json:"email"`
+		// Handle is optional, it can be claimed later with updateProfile.
+		Handle string `json:"handle"`
 	}
 
 	var params parameters
@@ -32,51 +40,87 @@ func (cfg *apiConfig) createUser(w http.ResponseWriter, r *http.Request) {
 		writeErrorJson(w, errors.New("email is too short"), "Email is too short")
 		return
 	}
+	if !account.ValidEmail(email) {
+		writeErrorJson(w, errors.New("email is invalid"), "Email is invalid")
+		return
+	}
+
+	handle := strings.TrimSpace(params.Handle)
+	if handle != "" {
+		if !account.ValidHandle(handle) {
+			writeErrorJson(w, errors.New("handle is invalid"), "Handles are 3 to 30 letters, digits or underscores")
+			return
+		}
+		err = cfg.checkHandleAvailable(r, handle, uuid.Nil)
+		if errors.Is(err, errHandleTaken) {
+			w.WriteHeader(http.StatusConflict)
+			writeErrorJson(w, err, "Handle is already taken")
+			return
+		}
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	hashedPassword, err := cfg.passwords.Hash(params.Password)
 	if err != nil {
 		writeErrorJson(w, err, "Something went wrong")
 		return
 	}
 
-	user, err := cfg.sql.CreateUser(r.Context(), database.CreateUserParams{email, hashedPassword})
+	user, err := cfg.sql.CreateUser(r.Context(), database.CreateUserParams{
+		Email:          email,
+		HashedPassword: hashedPassword,
+		Handle:         sql.NullString{String: handle, Valid: handle != ""},
+	})
+	if uniqueViolation(err, handleIndex) {
+		w.WriteHeader(http.StatusConflict)
+		writeErrorJson(w, errHandleTaken, "Handle is already taken")
+		return
+	}
 	if err != nil {
 		writeErrorJson(w, err, "Couldn't create user")
 		return
 	}
 
+	_, err = cfg.sql.ClaimVerificationEmail(r.Context(), database.ClaimVerificationEmailParams{ID: user.ID, SentBefore: time.Now()})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	cfg.sendVerificationEmail(user)
+
 	type response struct {
 		ID          uuid.UUID `json:"id"`
 		CreatedAt   time.Time `json:"created_at"`
 		UpdatedAt   time.Time `json:"updated_at"`
 		Email       string    `json:"email"`
+		Handle      string    `json:"handle,omitempty"`
 		IsChirpyRed bool      `json:"is_chirpy_red"`
 	}
-	resp := response{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, user.IsChirpyRed}
+	resp := response{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, user.Handle.String, user.IsChirpyRed}
 
 	writeSuccessJson(w, resp, http.StatusCreated)
 }
 
+// updateUser replaces the email and password of the caller. Both are
+// account security settings, so delegated tokens cannot change them, and
+// changing either takes the current password like in patchUser.
 func (cfg *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
-	token, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		writeErrorJson(w, err, "Something went wrong")
-		return
-	}
-
-	userID, err := auth.ValidateJWT(token, cfg.secret)
+	caller, err := cfg.authorizeSession(r)
 	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		writeErrorJson(w, err, "Something went wrong")
+		writeAuthError(w, err)
 		return
 	}
+	userID := caller.UserID
 
 	type parameters struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
+		Password        string `json:"password"`
+		Email           string `json:"email"`
+		CurrentPassword string `json:"current_password"`
 	}
 
 	var params parameters
@@ -92,26 +136,291 @@ func (cfg *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(params.Password)
+	current, err := cfg.sql.GetUserByID(r.Context(), userID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+
+	// A new email only takes effect once confirmed, see requestEmailChange.
+	emailChanged := email != current.Email
+	if emailChanged {
+		if !account.ValidEmail(email) {
+			writeErrorJson(w, errors.New("email is invalid"), "Email is invalid")
+			return
+		}
+		_, err = cfg.sql.GetUserByEmail(r.Context(), email)
+		if err == nil {
+			w.WriteHeader(http.StatusConflict)
+			writeErrorJson(w, errEmailTaken, "Email is already in use")
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+	}
+
+	if !account.ValidPassword(params.Password) {
+		writeErrorJson(w, errors.New("password is empty"), "Password must not be empty")
+		return
+	}
+
+	_, err = cfg.passwords.Verify(params.Password, current.HashedPassword)
+	passwordChanged := err != nil
+
+	if (emailChanged || passwordChanged) && !cfg.confirmPassword(w, r, current, params.CurrentPassword) {
+		return
+	}
+
+	hashedPassword, err := cfg.passwords.Hash(params.Password)
 	if err != nil {
 		writeErrorJson(w, err, "Something went wrong")
 		return
 	}
 
-	user, err := cfg.sql.UpdateUser(r.Context(), database.UpdateUserParams{ID: userID, Email: email, HashedPassword: hashedPassword})
+	user, err := cfg.sql.UpdateUser(r.Context(), database.UpdateUserParams{ID: userID, Email: current.Email, HashedPassword: hashedPassword})
 	if err != nil {
 		writeErrorJson(w, err, "Couldn't update user")
 		return
 	}
 
+	pendingEmail := ""
+	if emailChanged {
+		err = cfg.requestEmailChange(r.Context(), user, email)
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+		pendingEmail = email
+	}
+
+	// A new password logs out every other device, in case the old one leaked.
+	if passwordChanged {
+		err = cfg.revokeOtherSessions(r.Context(), userID, caller.SessionID())
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+	}
+
 	type response struct {
-		ID          uuid.UUID `json:"id"`
-		CreatedAt   time.Time `json:"created_at"`
-		UpdatedAt   time.Time `json:"updated_at"`
-		Email       string    `json:"email"`
-		IsChirpyRed bool      `json:"is_chirpy_red"`
+		ID           uuid.UUID `json:"id"`
+		CreatedAt    time.Time `json:"created_at"`
+		UpdatedAt    time.Time `json:"updated_at"`
+		Email        string    `json:"email"`
+		PendingEmail string    `json:"pending_email,omitempty"`
+		Handle       string    `json:"handle,omitempty"`
+		IsChirpyRed  bool      `json:"is_chirpy_red"`
 	}
-	resp := response{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, user.IsChirpyRed}
+	resp := response{user.ID, user.CreatedAt, user.UpdatedAt, user.Email, pendingEmail, user.Handle.String, user.IsChirpyRed}
 
 	writeSuccessJson(w, resp)
 }
+
+// patchUser applies a JSON merge patch (RFC 7396) to the caller's account,
+// touching only the fields it names. Delegated tokens with the
+// profile:write scope may only patch the profile. Changing the email or
+// password takes a login session and the current password, and a new email
+// waits for confirmation like in updateUser. Every invalid field is reported
+// at once.
+func (cfg *apiConfig) patchUser(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorize(r, auth.ScopeProfileWrite)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		writeErrorJson(w, fmt.Errorf("unsupported content type %q", mediaType), "Send a JSON merge patch")
+		return
+	}
+
+	var patch map[string]json.RawMessage
+	err = json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil || patch == nil {
+		writeErrorJson(w, errors.New("patch is not a json object"), "Send a JSON merge patch")
+		return
+	}
+
+	_, hasEmail := patch["email"]
+	_, hasPassword := patch["password"]
+	if (hasEmail || hasPassword) && caller.Scopes != nil {
+		writeAuthError(w, errSessionRequired)
+		return
+	}
+
+	current, err := cfg.sql.GetUserByID(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+
+	changes, fieldErrors := account.ParsePatch(patch, current.Email)
+
+	// Whether the new email and handle are free is only checked for values
+	// that are valid otherwise.
+	if changes.Email != nil {
+		_, err := cfg.sql.GetUserByEmail(r.Context(), *changes.Email)
+		if err == nil {
+			fieldErrors["email"] = "is already in use"
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+	}
+	if changes.Handle != nil && *changes.Handle != "" {
+		err := cfg.checkHandleAvailable(r, *changes.Handle, current.ID)
+		if errors.Is(err, errHandleTaken) {
+			fieldErrors["handle"] = "is already taken"
+		} else if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+	}
+	if len(fieldErrors) > 0 {
+		writeFieldErrors(w, fieldErrors)
+		return
+	}
+
+	if changes.ChangesCredentials() && !cfg.confirmPassword(w, r, current, changes.CurrentPassword) {
+		return
+	}
+
+	hashedPassword := current.HashedPassword
+	if changes.Password != nil {
+		hashedPassword, err = cfg.passwords.Hash(*changes.Password)
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+	}
+
+	profile := database.UpdateUserProfileParams{
+		ID:          current.ID,
+		Handle:      current.Handle,
+		DisplayName: current.DisplayName,
+		Bio:         current.Bio,
+		Location:    current.Location,
+		Website:     current.Website,
+	}
+	if changes.Handle != nil {
+		profile.Handle = sql.NullString{String: *changes.Handle, Valid: *changes.Handle != ""}
+	}
+	if changes.DisplayName != nil {
+		profile.DisplayName = *changes.DisplayName
+	}
+	if changes.Bio != nil {
+		profile.Bio = *changes.Bio
+	}
+	if changes.Location != nil {
+		profile.Location = *changes.Location
+	}
+	if changes.Website != nil {
+		profile.Website = *changes.Website
+	}
+
+	user, err := cfg.applyUserPatch(r.Context(), current, hashedPassword, profile, changes.Password != nil, changes.ChangesProfile())
+	if uniqueViolation(err, handleIndex) {
+		writeFieldErrors(w, map[string]string{"handle": "is already taken"})
+		return
+	}
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't update user")
+		return
+	}
+
+	newEmail := ""
+	if changes.Email != nil {
+		newEmail = *changes.Email
+		err = cfg.requestEmailChange(r.Context(), user, newEmail)
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+	}
+
+	// A new password logs out every other device, in case the old one leaked.
+	if changes.Password != nil {
+		err = cfg.revokeOtherSessions(r.Context(), current.ID, caller.SessionID())
+		if err != nil {
+			writeErrorJson(w, err, "Something went wrong")
+			return
+		}
+	}
+
+	type response struct {
+		ID           uuid.UUID `json:"id"`
+		CreatedAt    time.Time `json:"created_at"`
+		UpdatedAt    time.Time `json:"updated_at"`
+		Email        string    `json:"email"`
+		PendingEmail string    `json:"pending_email,omitempty"`
+		Handle       string    `json:"handle,omitempty"`
+		DisplayName  string    `json:"display_name"`
+		Bio          string    `json:"bio"`
+		Location     string    `json:"location"`
+		Website      string    `json:"website"`
+		IsChirpyRed  bool      `json:"is_chirpy_red"`
+	}
+	resp := response{
+		ID:           user.ID,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+		Email:        user.Email,
+		PendingEmail: newEmail,
+		Handle:       user.Handle.String,
+		DisplayName:  user.DisplayName,
+		Bio:          user.Bio,
+		Location:     user.Location,
+		Website:      user.Website,
+		IsChirpyRed:  user.IsChirpyRed,
+	}
+
+	writeSuccessJson(w, resp)
+}
+
+// applyUserPatch stores the patched password and profile of user in one
+// transaction, skipping the parts the patch left alone.
+func (cfg *apiConfig) applyUserPatch(ctx context.Context, user database.User, hashedPassword string, profile database.UpdateUserProfileParams, passwordChanged, profileChanged bool) (database.User, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.User{}, err
+	}
+	defer tx.Rollback()
+
+	q := cfg.sql.WithTx(tx)
+
+	if passwordChanged {
+		user, err = q.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{ID: user.ID, HashedPassword: hashedPassword})
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+	if profileChanged {
+		user, err = q.UpdateUserProfile(ctx, profile)
+		if err != nil {
+			return database.User{}, err
+		}
+	}
+
+	return user, tx.Commit()
+}
+
+// writeFieldErrors reports invalid request fields, mapping each field name
+// to what is wrong with it.
+func writeFieldErrors(w http.ResponseWriter, fieldErrors map[string]string) {
+	log.Printf("Error: invalid fields %v", fieldErrors)
+
+	type response struct {
+		Error  string            `json:"error"`
+		Fields map[string]string `json:"fields"`
+	}
+	resp := response{Error: "Some fields are invalid", Fields: fieldErrors}
+
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	_ = json.NewEncoder(w).Encode(resp)
+}
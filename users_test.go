@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUpdateUserRejectsEmptyPassword(t *testing.T) {
+	cfg, _ := newTestConfig(t)
+	createTestUser(t, cfg, "alice@example.com")
+	session := loginTestUser(t, cfg, "alice@example.com")
+
+	put := newJSONRequest(http.MethodPut, "/api/users", map[string]any{
+		"email":            "alice@example.com",
+		"password":         "",
+		"current_password": testPassword,
+	})
+	patch := newJSONRequest(http.MethodPatch, "/api/users", map[string]any{
+		"password":         "",
+		"current_password": testPassword,
+	})
+
+	for name, tt := range map[string]struct {
+		handler http.HandlerFunc
+		request *http.Request
+	}{
+		"PUT":   {cfg.updateUser, put},
+		"PATCH": {cfg.patchUser, patch},
+	} {
+		rr := serve(tt.handler, withBearer(tt.request, session.Token))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want %d, body %s", name, rr.Code, http.StatusBadRequest, rr.Body)
+		}
+	}
+
+	// The old password still works.
+	loginTestUser(t, cfg, "alice@example.com")
+}
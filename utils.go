@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 func writeErrorJson(w http.ResponseWriter, err error, message ...string) {
@@ -31,6 +37,52 @@ func writeSuccessJson(w http.ResponseWriter, resp any, statusCode ...int) {
 	}
 }
 
+// uniqueViolation reports whether err is Postgres rejecting a duplicate
+// value of the unique index or constraint named constraint.
+func uniqueViolation(err error, constraint string) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == constraint
+}
+
+// clientIP returns the address of the client that sent r. Behind a proxy it
+// is the last X-Forwarded-For entry, the one the proxy appended; the entries
+// before it come from the client and can be anything.
+func (cfg *apiConfig) clientIP(r *http.Request) string {
+	if cfg.trustProxy {
+		forwarded := r.Header.Values("X-Forwarded-For")
+		if len(forwarded) > 0 {
+			entries := strings.Split(forwarded[len(forwarded)-1], ",")
+			if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// runPeriodically calls job every interval until ctx is done.
+func runPeriodically(ctx context.Context, interval time.Duration, name string, job func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := job(ctx)
+			if err != nil {
+				log.Printf("Error running %s: %s", name, err)
+			}
+		}
+	}
+}
+
 func healthz(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"codingiam/chirpy/internal/auth"
+	"codingiam/chirpy/internal/database"
+	"codingiam/chirpy/internal/mailer"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	verifyEmailPurpose = "verify-email"
+	// verificationResendInterval is how long a user has to wait before
+	// another verification email is sent.
+	verificationResendInterval = 5 * time.Minute
+)
+
+// sendVerificationEmail mails user a link confirming their current address.
+// The link stops working if the address changes in the meantime.
+func (cfg *apiConfig) sendVerificationEmail(user database.User) {
+	token := auth.MakeSignedToken(cfg.secret, verifyEmailPurpose, user.ID.String()+" "+user.Email, 24*time.Hour)
+	link := cfg.baseURL + "/api/users/verify?token=" + url.QueryEscape(token)
+
+	cfg.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your Chirpy email address",
+		Body:    fmt.Sprintf("Welcome to Chirpy!\n\nPlease confirm your email address by opening this link within the next 24 hours:\n\n%s\n", link),
+	})
+}
+
+func (cfg *apiConfig) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	data, err := auth.VerifySignedToken(cfg.secret, verifyEmailPurpose, r.URL.Query().Get("token"))
+	if err != nil {
+		writeErrorJson(w, err, "Invalid or expired token")
+		return
+	}
+
+	paramUserID, email, _ := strings.Cut(data, " ")
+	userID, err := uuid.Parse(paramUserID)
+	if err != nil {
+		writeErrorJson(w, err, "Invalid or expired token")
+		return
+	}
+
+	user, err := cfg.sql.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{ID: userID, Email: email})
+	if err != nil {
+		writeErrorJson(w, err, "Invalid or expired token")
+		return
+	}
+
+	type response struct {
+		ID            uuid.UUID `json:"id"`
+		Email         string    `json:"email"`
+		EmailVerified bool      `json:"email_verified"`
+	}
+	resp := response{user.ID, user.Email, true}
+
+	writeSuccessJson(w, resp)
+}
+
+func (cfg *apiConfig) resendVerification(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	caller, err := cfg.authorize(r, auth.ScopeProfileWrite)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+
+	user, err := cfg.sql.GetUserByID(r.Context(), caller.UserID)
+	if err != nil {
+		writeErrorJson(w, err, "Couldn't get user")
+		return
+	}
+
+	if user.EmailVerifiedAt.Valid {
+		w.WriteHeader(http.StatusConflict)
+		writeErrorJson(w, errors.New("email already verified"), "Email is already verified")
+		return
+	}
+
+	rows, err := cfg.sql.ClaimVerificationEmail(r.Context(), database.ClaimVerificationEmailParams{
+		ID:         user.ID,
+		SentBefore: time.Now().Add(-verificationResendInterval),
+	})
+	if err != nil {
+		writeErrorJson(w, err, "Something went wrong")
+		return
+	}
+	if rows == 0 {
+		retryAfter := time.Until(user.VerificationSentAt.Time.Add(verificationResendInterval))
+		w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+		w.WriteHeader(http.StatusTooManyRequests)
+		writeErrorJson(w, errors.New("verification email rate limited"), "Please wait before requesting another email")
+		return
+	}
+
+	cfg.sendVerificationEmail(user)
+
+	writeSuccessJson(w, nil, http.StatusAccepted)
+}